@@ -1,8 +1,9 @@
 package jsonrpc
 
 import (
-	"github.com/zhouyaozhouyao/goframe-jsonrpc/client"
+	"context"
 	"errors"
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/client"
 )
 
 type ClientInterface interface {
@@ -10,6 +11,10 @@ type ClientInterface interface {
 	Call(string, interface{}, interface{}, bool) error // 建立请求 支持 x/y 和 x.y
 	BatchAppend(string, interface{}, interface{}, bool) *error
 	BatchCall() error
+	CallContext(context.Context, string, interface{}, interface{}, bool) error // 携带上下文调用，开启链路追踪时以 ctx 中的 span 为父节点
+	BatchCallContext(context.Context) error
+	Stream(string, interface{}) (*client.Stream, error) // 调用流式方法，仅 tcp 协议支持
+	Authenticate(authorization string) error            // 设置认证信息 如 Bearer xxx，tcp 协议通过 rpc.auth 握手认证当前连接
 }
 
 func NewClient(protocol string, ip string, port string) (ClientInterface, error) {
@@ -22,3 +27,12 @@ func NewClient(protocol string, ip string, port string) (ClientInterface, error)
 	}
 	return nil, errors.New("不支持当前协议")
 }
+
+// NewBalancedClient 实例化负载均衡客户端，按 options 中的策略将请求分发到 endpoints 中的服务端，地址格式为 ip:port
+func NewBalancedClient(protocol string, endpoints []string, options client.BalancerOptions) (ClientInterface, error) {
+	c, err := client.NewBalancedClient(protocol, endpoints, options)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,564 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+// ErrNoEndpoint 没有可用的服务端
+var ErrNoEndpoint = errors.New("rpc: 没有可用的服务端")
+
+// Balance 负载均衡策略
+type Balance int
+
+const (
+	RoundRobin     Balance = iota // 轮询
+	LeastInFlight                 // 选择进行中请求最少的服务端
+	ConsistentHash                // 按 HashKey 一致性哈希，相同的键发送到同一服务端，服务端增减时只影响少量的键
+)
+
+// Resolver 服务发现，返回服务端地址列表，地址格式为 ip:port
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// StaticResolver 固定的服务端地址列表
+type StaticResolver []string
+
+// Resolve 实现 Resolver
+func (r StaticResolver) Resolve(ctx context.Context) ([]string, error) {
+	return r, nil
+}
+
+// BalancerOptions 负载均衡配置
+type BalancerOptions struct {
+	Balance         Balance       // 负载均衡策略，默认为轮询
+	Resolver        Resolver      // 服务发现，为 nil 时使用创建时传入的地址列表
+	RefreshInterval time.Duration // 定时重新解析地址的间隔，为 0 时只在创建时解析一次
+
+	// HashKey 一致性哈希的键，为 nil 时使用 json 编码后的参数，批量请求使用第一个请求的键
+	HashKey  func(method string, params interface{}) string
+	Replicas int // 一致性哈希中每个服务端的虚拟节点数，不大于 0 时为 100
+
+	MaxFailures   int           // 连续失败达到该次数时摘除服务端，不大于 0 时为 3
+	EjectDuration time.Duration // 摘除的时间，到期后重新加入，重新加入后第一次请求失败时立即再次摘除，为 0 时为 30s
+	// IsFailure 判断错误是否计为失败，为 nil 时与熔断器的默认规则相同，熔断器打开的错误同样计为失败
+	IsFailure func(err error) bool
+	// OnEject 服务端被摘除或重新加入后第一次请求成功时调用
+	OnEject func(addr string, ejected bool)
+}
+
+// EndpointState 服务端的状态
+type EndpointState struct {
+	Addr     string `json:"addr"`
+	InFlight int64  `json:"inFlight"` // 进行中的请求数
+	Failures int    `json:"failures"` // 连续失败次数
+	Ejected  bool   `json:"ejected"`  // 是否被摘除
+}
+
+// Balanced 负载均衡客户端，将请求分发到多个服务端，每个服务端使用单独的 Http 或 Tcp 客户端
+// tcp 协议在第一次请求时建立连接，同一服务端的请求串行发送，流式调用使用单独的连接
+type Balanced struct {
+	RequestList []*common.SingleRequest
+
+	protocol      string
+	options       BalancerOptions
+	clientOptions interface{} // SetOptions 设置的 HttpOptions 或 TcpOptions
+	authorization string
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	ring      []ringNode // 一致性哈希环，按哈希值排序
+	next      uint32     // 轮询的位置
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// endpoint 单个服务端
+type endpoint struct {
+	addr     string
+	inFlight int64
+
+	mu     sync.Mutex     // 保护 client，tcp 协议同时用于串行发送请求
+	client endpointClient // 创建后不再修改选项，修改选项时替换为新的客户端
+
+	failures     int       // 由 Balanced.mu 保护
+	ejectedUntil time.Time // 由 Balanced.mu 保护，不为零值时表示被摘除过，第一次请求成功后清空
+}
+
+// endpointClient 单个服务端的客户端，由 Http 与 Tcp 实现
+type endpointClient interface {
+	SetOptions(options interface{})
+	CallContext(ctx context.Context, method string, params interface{}, result interface{}, isNotify bool) error
+	Stream(method string, params interface{}) (*Stream, error)
+	Authenticate(authorization string) error
+	batchCall(ctx context.Context, list []*common.SingleRequest) error
+}
+
+type ringNode struct {
+	hash uint32
+	e    *endpoint
+}
+
+// NewBalancedClient 实例化负载均衡客户端，endpoints 为服务端地址列表，设置了 Resolver 时忽略
+func NewBalancedClient(protocol string, endpoints []string, options BalancerOptions) (*Balanced, error) {
+	if protocol != "http" && protocol != "tcp" {
+		return nil, errors.New("不支持当前协议")
+	}
+	if options.Resolver == nil {
+		options.Resolver = StaticResolver(endpoints)
+	}
+	if options.Replicas <= 0 {
+		options.Replicas = 100
+	}
+	if options.MaxFailures <= 0 {
+		options.MaxFailures = 3
+	}
+	if options.EjectDuration <= 0 {
+		options.EjectDuration = 30 * time.Second
+	}
+	b := &Balanced{protocol: protocol, options: options, stop: make(chan struct{})}
+	if err := b.resolve(context.Background()); err != nil {
+		return nil, err
+	}
+	if options.RefreshInterval > 0 {
+		go b.watch()
+	}
+	return b, nil
+}
+
+// SetOptions 设置每个服务端客户端的选项，http 协议为 HttpOptions，tcp 协议为 TcpOptions
+// 已创建的客户端不再修改，之后的请求按新的选项创建客户端，进行中的请求不受影响，tcp 协议重新建立连接
+func (b *Balanced) SetOptions(options interface{}) {
+	b.mu.Lock()
+	b.clientOptions = options
+	list := b.endpoints
+	b.mu.Unlock()
+	for _, e := range list {
+		e.close()
+	}
+}
+
+// Authenticate 设置认证信息，tcp 协议为已建立的连接重新握手，之后建立的连接同样握手
+// http 协议的请求不持有锁，之后的请求按新的认证信息创建客户端
+func (b *Balanced) Authenticate(authorization string) error {
+	b.mu.Lock()
+	b.authorization = authorization
+	list := b.endpoints
+	b.mu.Unlock()
+	var err error
+	for _, e := range list {
+		if b.protocol != "tcp" {
+			e.close()
+			continue
+		}
+		e.mu.Lock()
+		if e.client != nil {
+			if e2 := e.client.Authenticate(authorization); e2 != nil && err == nil {
+				err = e2
+			}
+		}
+		e.mu.Unlock()
+	}
+	return err
+}
+
+func (b *Balanced) Call(method string, params interface{}, result interface{}, isNotify bool) error {
+	return b.CallContext(context.Background(), method, params, result, isNotify)
+}
+
+// CallContext 选择服务端后调用，熔断器打开时换一个服务端
+func (b *Balanced) CallContext(ctx context.Context, method string, params interface{}, result interface{}, isNotify bool) error {
+	return b.do(b.hashKey(method, params), func(c endpointClient) error {
+		return c.CallContext(ctx, method, params, result, isNotify)
+	})
+}
+
+// BatchAppend 批量追加
+func (b *Balanced) BatchAppend(method string, params interface{}, result interface{}, isNotify bool) *error {
+	singleRequest := &common.SingleRequest{
+		Method:   method,
+		Params:   params,
+		Result:   result,
+		Error:    new(error),
+		IsNotify: isNotify,
+	}
+	b.RequestList = append(b.RequestList, singleRequest)
+	return singleRequest.Error
+}
+
+func (b *Balanced) BatchCall() error {
+	return b.BatchCallContext(context.Background())
+}
+
+// BatchCallContext 批量请求整体发送到同一个服务端
+func (b *Balanced) BatchCallContext(ctx context.Context) error {
+	list := b.RequestList
+	b.RequestList = make([]*common.SingleRequest, 0)
+	return b.batchCall(ctx, list)
+}
+
+// batchCall 将批量请求发送到选择的服务端，服务端的客户端在多个协程之间共用，请求列表只通过参数传递
+func (b *Balanced) batchCall(ctx context.Context, list []*common.SingleRequest) error {
+	if len(list) == 0 {
+		return nil
+	}
+	return b.do(b.hashKey(list[0].Method, list[0].Params), func(c endpointClient) error {
+		return c.batchCall(ctx, list)
+	})
+}
+
+// Stream 选择服务端后使用单独的连接调用流式方法，迭代器读取完毕或 Close 后关闭该连接，不影响同一服务端的其它请求
+func (b *Balanced) Stream(method string, params interface{}) (*Stream, error) {
+	var s *Stream
+	err := b.failover(b.hashKey(method, params), func(e *endpoint) (err error) {
+		s, err = b.stream(e, method, params)
+		return err
+	})
+	return s, err
+}
+
+// Endpoints 返回所有服务端的状态
+func (b *Balanced) Endpoints() []EndpointState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	states := make([]EndpointState, len(b.endpoints))
+	for i, e := range b.endpoints {
+		states[i] = EndpointState{
+			Addr:     e.addr,
+			InFlight: atomic.LoadInt64(&e.inFlight),
+			Failures: e.failures,
+			Ejected:  e.ejected(now),
+		}
+	}
+	return states
+}
+
+// Close 停止服务发现并关闭所有 tcp 连接
+func (b *Balanced) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.stop)
+	})
+	b.mu.Lock()
+	list := b.endpoints
+	b.mu.Unlock()
+	for _, e := range list {
+		e.close()
+	}
+	return nil
+}
+
+// do 选择服务端后使用该服务端的客户端执行 call
+func (b *Balanced) do(key string, call func(c endpointClient) error) error {
+	return b.failover(key, func(e *endpoint) error {
+		return b.invoke(e, call)
+	})
+}
+
+// failover 选择服务端执行 fn，熔断器打开时请求没有发送，换一个服务端重试
+func (b *Balanced) failover(key string, fn func(e *endpoint) error) error {
+	tried := make(map[*endpoint]bool)
+	err := ErrNoEndpoint
+	for {
+		e := b.pick(key, tried)
+		if e == nil {
+			return err
+		}
+		if err = fn(e); err != ErrCircuitOpen {
+			return err
+		}
+		tried[e] = true
+	}
+}
+
+func (b *Balanced) invoke(e *endpoint, call func(c endpointClient) error) error {
+	atomic.AddInt64(&e.inFlight, 1)
+	defer atomic.AddInt64(&e.inFlight, -1)
+	// tcp 连接不能并发使用，持有锁直到请求结束
+	serial := b.protocol == "tcp"
+	e.mu.Lock()
+	c, err := b.connect(e)
+	if !serial {
+		e.mu.Unlock()
+	}
+	if err == nil {
+		err = call(c)
+	}
+	if serial {
+		e.mu.Unlock()
+	}
+	b.report(e, err)
+	return err
+}
+
+// stream 使用新建的客户端调用流式方法，流结束时关闭客户端并记录结果
+func (b *Balanced) stream(e *endpoint, method string, params interface{}) (*Stream, error) {
+	atomic.AddInt64(&e.inFlight, 1)
+	c, err := b.dial(e)
+	var s *Stream
+	if err == nil {
+		if s, err = c.Stream(method, params); err != nil {
+			closeClient(c)
+		}
+	}
+	if err != nil {
+		atomic.AddInt64(&e.inFlight, -1)
+		b.report(e, err)
+		return nil, err
+	}
+	s.onFinish = func() {
+		closeClient(c)
+		atomic.AddInt64(&e.inFlight, -1)
+		b.report(e, s.Err())
+	}
+	return s, nil
+}
+
+// connect 返回服务端的客户端，第一次调用时创建，需要持有 e.mu
+func (b *Balanced) connect(e *endpoint) (endpointClient, error) {
+	if e.client != nil {
+		return e.client, nil
+	}
+	c, err := b.dial(e)
+	if err != nil {
+		return nil, err
+	}
+	e.client = c
+	return c, nil
+}
+
+// dial 按当前的选项与认证信息创建服务端的客户端，tcp 协议同时建立连接
+func (b *Balanced) dial(e *endpoint) (endpointClient, error) {
+	ip, port, err := net.SplitHostPort(e.addr)
+	if err != nil {
+		return nil, err
+	}
+	var c endpointClient
+	if b.protocol == "tcp" {
+		t, err := NewTcpClient(ip, port)
+		if err != nil {
+			return nil, &common.TransportError{Err: err}
+		}
+		c = t
+	} else {
+		c = NewHttpClient(ip, port)
+	}
+	b.mu.Lock()
+	options, authorization := b.clientOptions, b.authorization
+	b.mu.Unlock()
+	if options != nil {
+		c.SetOptions(options)
+	}
+	if authorization != "" {
+		if err = c.Authenticate(authorization); err != nil {
+			closeClient(c)
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// pick 按策略选择一个未尝试过的服务端，所有服务端都被摘除时仍然从中选择，避免全部不可用
+func (b *Balanced) pick(key string, tried map[*endpoint]bool) *endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	candidates := make([]*endpoint, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		if !tried[e] && !e.ejected(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, e := range b.endpoints {
+			if !tried[e] {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	n := len(candidates)
+	if n == 0 {
+		return nil
+	}
+	switch b.options.Balance {
+	case LeastInFlight:
+		// 从轮询的位置开始比较，进行中请求数相同时轮流选择
+		start := int(b.next % uint32(n))
+		b.next++
+		best := candidates[start]
+		for i := 1; i < n; i++ {
+			e := candidates[(start+i)%n]
+			if atomic.LoadInt64(&e.inFlight) < atomic.LoadInt64(&best.inFlight) {
+				best = e
+			}
+		}
+		return best
+	case ConsistentHash:
+		allowed := make(map[*endpoint]bool, n)
+		for _, e := range candidates {
+			allowed[e] = true
+		}
+		h := crc32.ChecksumIEEE([]byte(key))
+		i := sort.Search(len(b.ring), func(i int) bool {
+			return b.ring[i].hash >= h
+		})
+		// 顺时针找到第一个可用的服务端
+		for j := 0; j < len(b.ring); j++ {
+			if node := b.ring[(i+j)%len(b.ring)]; allowed[node.e] {
+				return node.e
+			}
+		}
+		return candidates[0]
+	}
+	e := candidates[b.next%uint32(n)]
+	b.next++
+	return e
+}
+
+// report 记录请求结果，连续失败达到 MaxFailures 次时摘除服务端
+func (b *Balanced) report(e *endpoint, err error) {
+	failed := err == ErrCircuitOpen || b.isFailure(err)
+	b.mu.Lock()
+	var (
+		changed bool
+		ejected bool
+	)
+	switch {
+	case !failed:
+		e.failures = 0
+		if !e.ejectedUntil.IsZero() {
+			e.ejectedUntil = time.Time{}
+			changed = true
+		}
+	case !e.ejected(time.Now()):
+		e.failures++
+		// 重新加入后第一次请求失败时立即摘除
+		if e.failures >= b.options.MaxFailures || !e.ejectedUntil.IsZero() {
+			e.ejectedUntil = time.Now().Add(b.options.EjectDuration)
+			changed, ejected = true, true
+		}
+	}
+	b.mu.Unlock()
+	if changed && b.options.OnEject != nil {
+		b.options.OnEject(e.addr, ejected)
+	}
+}
+
+func (b *Balanced) isFailure(err error) bool {
+	if b.options.IsFailure != nil {
+		return err != nil && b.options.IsFailure(err)
+	}
+	return isServerFailure(err)
+}
+
+// hashKey 一致性哈希的键，其它策略不需要
+func (b *Balanced) hashKey(method string, params interface{}) string {
+	if b.options.Balance != ConsistentHash {
+		return ""
+	}
+	if b.options.HashKey != nil {
+		return b.options.HashKey(method, params)
+	}
+	key, _ := json.Marshal(common.StructuredParams(params))
+	return string(key)
+}
+
+// resolve 解析服务端地址并更新列表，保留仍然存在的服务端的连接与状态
+func (b *Balanced) resolve(ctx context.Context) error {
+	addrs, err := b.options.Resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return ErrNoEndpoint
+	}
+	b.mu.Lock()
+	old := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		old[e.addr] = e
+	}
+	list := make([]*endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		if e, ok := old[addr]; ok {
+			list = append(list, e)
+			delete(old, addr)
+			continue
+		}
+		if !containsAddr(list, addr) {
+			list = append(list, &endpoint{addr: addr})
+		}
+	}
+	ring := make([]ringNode, 0, len(list)*b.options.Replicas)
+	for _, e := range list {
+		for i := 0; i < b.options.Replicas; i++ {
+			ring = append(ring, ringNode{hash: crc32.ChecksumIEEE([]byte(e.addr + "#" + strconv.Itoa(i))), e: e})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	b.endpoints, b.ring = list, ring
+	b.mu.Unlock()
+	for _, e := range old {
+		e.close()
+	}
+	return nil
+}
+
+// watch 定时重新解析地址，解析失败时保留原有的服务端
+func (b *Balanced) watch() {
+	ticker := time.NewTicker(b.options.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			ctx := context.Background()
+			if err := b.resolve(ctx); err != nil {
+				common.GetLogger().Log(ctx, common.LevelWarn, "rpc resolve", common.Field{Key: "error", Value: err.Error()})
+			}
+		}
+	}
+}
+
+func (e *endpoint) ejected(now time.Time) bool {
+	return now.Before(e.ejectedUntil)
+}
+
+func (e *endpoint) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client != nil {
+		closeClient(e.client)
+		e.client = nil
+	}
+}
+
+func closeClient(c endpointClient) {
+	if closer, ok := c.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+func containsAddr(list []*endpoint, addr string) bool {
+	for _, e := range list {
+		if e.addr == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/server"
+)
+
+type rowsArgs struct {
+	N int `json:"n"`
+}
+
+type exportService struct{}
+
+func (exportService) Rows(args *rowsArgs, stream *common.Stream) error {
+	for i := 0; i < args.N; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (exportService) Double(args *rowsArgs, result *int) error {
+	*result = args.N * 2
+	return nil
+}
+
+// freePort 返回一个空闲的本地端口
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// waitListening 等待服务端开始监听
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not listening: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startServer 启动注册了 export 服务的服务端，configure 在启动前修改服务端配置
+func startServer(t *testing.T, protocol string, configure ...func(svr *common.Server)) string {
+	t.Helper()
+	port := freePort(t)
+	var svr *common.Server
+	var start func()
+	var shutdown func(ctx context.Context) error
+	if protocol == "tcp" {
+		s := server.NewTcpServer("127.0.0.1", port)
+		svr, start, shutdown = &s.Server, s.Start, s.Shutdown
+	} else {
+		s := server.NewHttpServer("127.0.0.1", port)
+		svr, start, shutdown = &s.Server, s.Start, s.Shutdown
+	}
+	if err := svr.RegisterName("export", exportService{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range configure {
+		f(svr)
+	}
+	go start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = shutdown(ctx)
+	})
+	addr := net.JoinHostPort("127.0.0.1", port)
+	waitListening(t, addr)
+	return addr
+}
+
+// 并发的批量请求共用同一个服务端的客户端时互不影响
+func TestBalancedConcurrentBatches(t *testing.T) {
+	for _, protocol := range []string{"http", "tcp"} {
+		t.Run(protocol, func(t *testing.T) {
+			b, err := NewBalancedClient(protocol, []string{startServer(t, protocol)}, BalancerOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					results := make([]int, 3)
+					list := make([]*common.SingleRequest, len(results))
+					for i := range list {
+						list[i] = &common.SingleRequest{Method: "export.double", Params: &rowsArgs{N: g*10 + i}, Result: &results[i], Error: new(error)}
+					}
+					if err := b.batchCall(context.Background(), list); err != nil {
+						t.Errorf("batch %d: %v", g, err)
+						return
+					}
+					for i, r := range results {
+						if want := (g*10 + i) * 2; r != want || *list[i].Error != nil {
+							t.Errorf("batch %d[%d] = %d %v, want %d", g, i, r, *list[i].Error, want)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// 流式调用使用单独的连接，读取过程中可以向同一服务端发起其它请求
+func TestBalancedStreamUsesDedicatedConnection(t *testing.T) {
+	b, err := NewBalancedClient("tcp", []string{startServer(t, "tcp")}, BalancerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	s, err := b.Stream("export.rows", &rowsArgs{N: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Next() {
+		t.Fatalf("first chunk: %v", s.Err())
+	}
+	if got := b.Endpoints()[0].InFlight; got != 1 {
+		t.Errorf("in flight %d while streaming, want 1", got)
+	}
+	done := make(chan error, 1)
+	var doubled int
+	go func() {
+		done <- b.Call("export.double", &rowsArgs{N: 21}, &doubled, false)
+	}()
+	select {
+	case err = <-done:
+		if err != nil || doubled != 42 {
+			t.Fatalf("call during stream: %d %v", doubled, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("call blocked by an unfinished stream")
+	}
+
+	rows := []int{}
+	for ok := true; ok; ok = s.Next() {
+		var row int
+		if err = s.Scan(&row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if s.Err() != nil || s.Count() != 3 || fmt.Sprint(rows) != "[0 1 2]" {
+		t.Fatalf("rows %v count %d err %v", rows, s.Count(), s.Err())
+	}
+	if got := b.Endpoints()[0].InFlight; got != 0 {
+		t.Errorf("in flight %d after stream finished, want 0", got)
+	}
+
+	// 提前关闭同样释放连接
+	s, err = b.Stream("export.rows", &rowsArgs{N: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Close()
+	if s.Next() {
+		t.Error("closed stream returned a chunk")
+	}
+	if st := b.Endpoints()[0]; st.InFlight != 0 || st.Failures != 0 {
+		t.Errorf("endpoint after close: %+v", st)
+	}
+}
+
+// 请求过程中修改选项与认证信息，进行中的请求使用原来的客户端，之后的请求使用新的选项
+func TestBalancedSetOptionsDuringRequests(t *testing.T) {
+	for _, protocol := range []string{"http", "tcp"} {
+		t.Run(protocol, func(t *testing.T) {
+			addr := startServer(t, protocol, func(svr *common.Server) {
+				svr.SetAuth(common.AuthOptions{Authenticators: []common.Authenticator{
+					common.BearerAuth(func(ctx context.Context, token string) (*common.Principal, error) {
+						return &common.Principal{Id: token}, nil
+					}),
+				}})
+			})
+			b, err := NewBalancedClient(protocol, []string{addr}, BalancerOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if err = b.Authenticate("Bearer init"); err != nil {
+				t.Fatal(err)
+			}
+			options := func(i int) interface{} {
+				if protocol == "tcp" {
+					return TcpOptions{PackageEof: "\r\n", PackageMaxLength: 1024 * 1024 * 2, CompressThreshold: 1024 + i}
+				}
+				return HttpOptions{PackageMaxLength: 1024 * 1024 * 2, DisableCompression: i%2 == 0}
+			}
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for g := 0; g < 4; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; ; i++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						var doubled int
+						if err := b.Call("export.double", &rowsArgs{N: g + i}, &doubled, false); err != nil || doubled != (g+i)*2 {
+							t.Errorf("call %d/%d = %d %v", g, i, doubled, err)
+							return
+						}
+					}
+				}(g)
+			}
+			for i := 0; i < 50; i++ {
+				b.SetOptions(options(i))
+				_ = b.Authenticate("Bearer " + strconv.Itoa(i))
+				time.Sleep(time.Millisecond)
+			}
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+// ErrCircuitOpen 熔断器打开时直接返回的错误，请求不会发送到服务端
+var ErrCircuitOpen = errors.New("rpc: 熔断器已打开，请求被拒绝")
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	StateClosed   BreakerState = iota // 关闭，请求正常通过
+	StateOpen                         // 打开，请求直接返回 ErrCircuitOpen
+	StateHalfOpen                     // 半开，允许少量探测请求通过
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	}
+	return "half-open"
+}
+
+// BreakerOptions 熔断配置
+type BreakerOptions struct {
+	FailureThreshold int           // 连续失败达到该次数时打开，不大于 0 时为 5
+	CoolDown         time.Duration // 打开后经过该时间进入半开状态，为 0 时为 10s
+	HalfOpenRequests int           // 半开状态允许同时通过的探测请求数，全部成功后关闭，不大于 0 时为 1
+	PerMethod        bool          // 每个方法单独熔断，否则同一服务端的所有方法共用
+
+	// IsFailure 判断错误是否计为失败，为 nil 时网络错误以及 -32603 内部错误、-32002 过载错误计为失败
+	// 参数错误、方法不存在等业务错误不影响熔断
+	IsFailure func(err error) bool
+	// OnStateChange 状态变化时调用，name 为服务端地址，按方法熔断时为 地址/方法名
+	// 在释放熔断器的锁之后调用，回调中可以调用 State
+	OnStateChange func(name string, from BreakerState, to BreakerState)
+}
+
+// Breaker 熔断器，按服务端地址熔断，可以在多个客户端之间共享
+type Breaker struct {
+	o        BreakerOptions
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit 单个服务端或方法的熔断状态
+type circuit struct {
+	state      BreakerState
+	generation int       // 状态变化时递增，忽略状态变化前发出的请求的结果
+	failures   int       // 关闭状态下连续失败的次数
+	openedAt   time.Time // 打开的时间
+	probes     int       // 半开状态下已放行的探测请求数
+	successes  int       // 半开状态下成功的探测请求数
+}
+
+// NewBreaker 创建熔断器
+func NewBreaker(o BreakerOptions) *Breaker {
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = 5
+	}
+	if o.CoolDown <= 0 {
+		o.CoolDown = 10 * time.Second
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = 1
+	}
+	return &Breaker{o: o, circuits: make(map[string]*circuit)}
+}
+
+// State 返回服务端或方法当前的熔断状态
+func (b *Breaker) State(addr string, method string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[b.name(addr, method)]
+	if !ok {
+		return StateClosed
+	}
+	if c.state == StateOpen && time.Since(c.openedAt) >= b.o.CoolDown {
+		return StateHalfOpen
+	}
+	return c.state
+}
+
+// Do 熔断器允许时执行 call 并记录结果，打开时直接返回 ErrCircuitOpen，b 为 nil 时直接执行
+func (b *Breaker) Do(addr string, method string, call func() error) error {
+	if b == nil {
+		return call()
+	}
+	name := b.name(addr, method)
+	generation, ok := b.allow(name)
+	if !ok {
+		return ErrCircuitOpen
+	}
+	err := call()
+	b.done(name, generation, err)
+	return err
+}
+
+func (b *Breaker) name(addr string, method string) string {
+	if b.o.PerMethod {
+		return addr + "/" + method
+	}
+	return addr
+}
+
+// allow 检测是否放行请求，返回放行时的状态代数
+func (b *Breaker) allow(name string) (int, bool) {
+	var change *stateChange
+	b.mu.Lock()
+	defer func() {
+		b.mu.Unlock()
+		b.notify(change)
+	}()
+	c, ok := b.circuits[name]
+	if !ok {
+		c = &circuit{}
+		b.circuits[name] = c
+	}
+	switch c.state {
+	case StateOpen:
+		if time.Since(c.openedAt) < b.o.CoolDown {
+			return 0, false
+		}
+		change = b.transition(name, c, StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if c.probes >= b.o.HalfOpenRequests {
+			return 0, false
+		}
+		c.probes++
+	}
+	return c.generation, true
+}
+
+// done 记录请求结果并更新状态
+func (b *Breaker) done(name string, generation int, err error) {
+	failed := b.isFailure(err)
+	var change *stateChange
+	b.mu.Lock()
+	defer func() {
+		b.mu.Unlock()
+		b.notify(change)
+	}()
+	c := b.circuits[name]
+	if c.generation != generation {
+		return
+	}
+	switch c.state {
+	case StateClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		if c.failures++; c.failures >= b.o.FailureThreshold {
+			change = b.transition(name, c, StateOpen)
+		}
+	case StateHalfOpen:
+		if failed {
+			change = b.transition(name, c, StateOpen)
+			return
+		}
+		if c.successes++; c.successes >= b.o.HalfOpenRequests {
+			change = b.transition(name, c, StateClosed)
+		}
+	}
+}
+
+// stateChange 一次状态变化，释放锁之后再通知 OnStateChange，回调中可以调用 State
+type stateChange struct {
+	name string
+	from BreakerState
+	to   BreakerState
+}
+
+// transition 在持有锁时更新状态，返回需要通知的状态变化
+func (b *Breaker) transition(name string, c *circuit, to BreakerState) *stateChange {
+	from := c.state
+	c.state, c.generation = to, c.generation+1
+	c.failures, c.probes, c.successes = 0, 0, 0
+	if to == StateOpen {
+		c.openedAt = time.Now()
+	}
+	return &stateChange{name: name, from: from, to: to}
+}
+
+// notify 通知状态变化，需要在释放锁之后调用
+func (b *Breaker) notify(change *stateChange) {
+	if change != nil && b.o.OnStateChange != nil {
+		b.o.OnStateChange(change.name, change.from, change.to)
+	}
+}
+
+func (b *Breaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if b.o.IsFailure != nil {
+		return b.o.IsFailure(err)
+	}
+	return isServerFailure(err)
+}
+
+// isServerFailure 错误是否表示服务端异常，网络错误以及内部错误、过载错误计为服务端异常
+func isServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	// 调用方取消或超时不代表服务端异常
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch e := err.(type) {
+	case *common.TransportError:
+		return true
+	case *common.Error:
+		return e.Code == common.InternalError || e.Code == common.Overloaded
+	}
+	return false
+}
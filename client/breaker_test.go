@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+const testAddr = "127.0.0.1:8000"
+
+var errTransport = &common.TransportError{Err: errors.New("connection refused")}
+
+type transitionLog []string
+
+func (l *transitionLog) record(name string, from BreakerState, to BreakerState) {
+	*l = append(*l, fmt.Sprintf("%s %s->%s", name, from, to))
+}
+
+func fail(err error) func() error {
+	return func() error { return err }
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	var log transitionLog
+	b := NewBreaker(BreakerOptions{FailureThreshold: 3, CoolDown: 20 * time.Millisecond, OnStateChange: log.record})
+
+	// 成功的请求重置连续失败次数
+	b.Do(testAddr, "a", fail(errTransport))
+	b.Do(testAddr, "a", fail(errTransport))
+	b.Do(testAddr, "a", fail(nil))
+	b.Do(testAddr, "a", fail(errTransport))
+	b.Do(testAddr, "a", fail(errTransport))
+	if s := b.State(testAddr, "a"); s != StateClosed {
+		t.Fatalf("state %s, want closed", s)
+	}
+	b.Do(testAddr, "a", fail(errTransport))
+	if s := b.State(testAddr, "a"); s != StateOpen {
+		t.Fatalf("state %s, want open", s)
+	}
+
+	// 打开时请求不会执行
+	called := false
+	if err := b.Do(testAddr, "b", func() error { called = true; return nil }); err != ErrCircuitOpen || called {
+		t.Fatalf("open breaker: err %v, called %v", err, called)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if s := b.State(testAddr, "a"); s != StateHalfOpen {
+		t.Fatalf("state %s after cool down, want half-open", s)
+	}
+	// 半开状态探测成功后关闭
+	if err := b.Do(testAddr, "a", fail(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.State(testAddr, "a"); s != StateClosed {
+		t.Fatalf("state %s after probe, want closed", s)
+	}
+	want := []string{testAddr + " closed->open", testAddr + " open->half-open", testAddr + " half-open->closed"}
+	if fmt.Sprint(log) != fmt.Sprint(want) {
+		t.Errorf("transitions %v, want %v", log, want)
+	}
+}
+
+func TestBreakerProbeFailureReopens(t *testing.T) {
+	b := NewBreaker(BreakerOptions{FailureThreshold: 1, CoolDown: 20 * time.Millisecond})
+	b.Do(testAddr, "a", fail(errTransport))
+	time.Sleep(25 * time.Millisecond)
+
+	// 半开状态只放行 HalfOpenRequests 个探测请求
+	probe, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(testAddr, "a", func() error {
+			close(probe)
+			<-release
+			return &common.Error{Code: common.Overloaded}
+		})
+	}()
+	<-probe
+	if err := b.Do(testAddr, "a", fail(nil)); err != ErrCircuitOpen {
+		t.Errorf("second probe: got %v, want %v", err, ErrCircuitOpen)
+	}
+	close(release)
+	<-done
+	if s := b.State(testAddr, "a"); s != StateOpen {
+		t.Fatalf("state %s after failed probe, want open", s)
+	}
+	if err := b.Do(testAddr, "a", fail(nil)); err != ErrCircuitOpen {
+		t.Errorf("reopened breaker: got %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestBreakerIgnoresBusinessErrors(t *testing.T) {
+	b := NewBreaker(BreakerOptions{FailureThreshold: 1})
+	for _, err := range []error{
+		&common.Error{Code: common.InvalidParams},
+		&common.Error{Code: common.MethodNotFound},
+		&common.Error{Code: common.Unauthorized},
+		context.Canceled,
+		fmt.Errorf("call: %w", context.DeadlineExceeded),
+	} {
+		b.Do(testAddr, "a", fail(err))
+		if s := b.State(testAddr, "a"); s != StateClosed {
+			t.Fatalf("%v opened the breaker", err)
+		}
+	}
+	b.Do(testAddr, "a", fail(&common.Error{Code: common.InternalError}))
+	if s := b.State(testAddr, "a"); s != StateOpen {
+		t.Errorf("internal error: state %s, want open", s)
+	}
+}
+
+func TestBreakerPerMethod(t *testing.T) {
+	b := NewBreaker(BreakerOptions{FailureThreshold: 1, PerMethod: true})
+	b.Do(testAddr, "a", fail(errTransport))
+	if s := b.State(testAddr, "a"); s != StateOpen {
+		t.Fatalf("method a: state %s, want open", s)
+	}
+	if err := b.Do(testAddr, "b", fail(nil)); err != nil {
+		t.Errorf("method b: %v", err)
+	}
+	if err := b.Do("127.0.0.1:8001", "a", fail(nil)); err != nil {
+		t.Errorf("other server: %v", err)
+	}
+
+	// 共用熔断器时同一服务端的所有方法一起打开
+	shared := NewBreaker(BreakerOptions{FailureThreshold: 1})
+	shared.Do(testAddr, "a", fail(errTransport))
+	if err := shared.Do(testAddr, "b", fail(nil)); err != ErrCircuitOpen {
+		t.Errorf("shared breaker: got %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestBreakerNil(t *testing.T) {
+	var b *Breaker
+	if err := b.Do(testAddr, "a", fail(errTransport)); err != errTransport {
+		t.Errorf("nil breaker: got %v", err)
+	}
+}
+
+// OnStateChange 在释放锁之后调用，回调中调用 State 不会死锁
+func TestBreakerCallbackCallsState(t *testing.T) {
+	var b *Breaker
+	var states []BreakerState
+	b = NewBreaker(BreakerOptions{FailureThreshold: 1, CoolDown: 20 * time.Millisecond, OnStateChange: func(name string, from BreakerState, to BreakerState) {
+		states = append(states, b.State(testAddr, "a"))
+	}})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Do(testAddr, "a", fail(errTransport))
+		time.Sleep(25 * time.Millisecond)
+		b.Do(testAddr, "a", fail(nil))
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnStateChange calling State deadlocked")
+	}
+	// 回调看到的是变化后的状态
+	want := []BreakerState{StateOpen, StateHalfOpen, StateClosed}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Errorf("states in callback %v, want %v", states, want)
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/server"
+)
+
+type blobArgs struct {
+	Data []byte    `json:"data"`
+	Big  int64     `json:"big"`
+	At   time.Time `json:"at"`
+}
+
+type blobResult struct {
+	Data []byte    `json:"data"`
+	Len  int       `json:"len"`
+	Big  int64     `json:"big"`
+	At   time.Time `json:"at"`
+}
+
+type blobService struct{}
+
+func (blobService) Echo(args *blobArgs, result *blobResult) error {
+	*result = blobResult{Data: args.Data, Len: len(args.Data), Big: args.Big, At: args.At}
+	return nil
+}
+
+// startCodecServer 启动使用指定编码的服务端，tcp 协议使用长度检测协议
+func startCodecServer(t *testing.T, protocol string, codec common.Codec) string {
+	t.Helper()
+	port := freePort(t)
+	var svr *common.Server
+	var start func()
+	var shutdown func(ctx context.Context) error
+	if protocol == "tcp" {
+		s := server.NewTcpServer("127.0.0.1", port)
+		options := s.Options
+		options.Codec, options.PackageLengthCheck = codec, true
+		s.SetOptions(options)
+		svr, start, shutdown = &s.Server, s.Start, s.Shutdown
+	} else {
+		// http 服务端按请求的 Content-Type 协商编码
+		s := server.NewHttpServer("127.0.0.1", port)
+		svr, start, shutdown = &s.Server, s.Start, s.Shutdown
+	}
+	if err := svr.RegisterName("blob", blobService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.RegisterName("export", exportService{}); err != nil {
+		t.Fatal(err)
+	}
+	go start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = shutdown(ctx)
+	})
+	addr := net.JoinHostPort("127.0.0.1", port)
+	waitListening(t, addr)
+	return addr
+}
+
+type codecClient interface {
+	Call(method string, params interface{}, result interface{}, isNotify bool) error
+	batchCall(ctx context.Context, list []*common.SingleRequest) error
+}
+
+func newCodecClient(t *testing.T, protocol string, addr string, codec common.Codec) codecClient {
+	t.Helper()
+	ip, port, _ := net.SplitHostPort(addr)
+	if protocol == "tcp" {
+		c := dialTcp(t, addr)
+		options := c.Options
+		options.Codec, options.PackageLengthCheck = codec, true
+		c.SetOptions(options)
+		return c
+	}
+	c := NewHttpClient(ip, port)
+	c.SetOptions(HttpOptions{Codec: codec})
+	return c
+}
+
+// 二进制数据、大整数与时间在各编码下直接传输，不经过 json 转换
+func TestCodecRoundTrip(t *testing.T) {
+	args := &blobArgs{Data: []byte{0, 1, 2, 0xff, '"'}, Big: 1<<60 + 1, At: time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)}
+	for _, codec := range []common.Codec{common.JSON, common.MsgPack, common.CBOR} {
+		for _, protocol := range []string{"http", "tcp"} {
+			t.Run(codec.Name()+"/"+protocol, func(t *testing.T) {
+				c := newCodecClient(t, protocol, startCodecServer(t, protocol, codec), codec)
+
+				var res blobResult
+				if err := c.Call("blob.echo", args, &res, false); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(res.Data, args.Data) || res.Len != len(args.Data) || res.Big != args.Big || !res.At.Equal(args.At) {
+					t.Errorf("echo = %+v, want %+v", res, args)
+				}
+
+				var doubled int
+				var batch blobResult
+				list := []*common.SingleRequest{
+					{Method: "export.double", Params: &rowsArgs{N: 21}, Result: &doubled, Error: new(error)},
+					{Method: "blob.echo", Params: args, Result: &batch, Error: new(error)},
+					{Method: "blob.missing", Params: args, Error: new(error)},
+				}
+				if err := c.batchCall(context.Background(), list); err != nil {
+					t.Fatal(err)
+				}
+				e1, e2, e3 := list[0].Error, list[1].Error, list[2].Error
+				if *e1 != nil || doubled != 42 || *e2 != nil || !bytes.Equal(batch.Data, args.Data) {
+					t.Errorf("batch: %d %v, %+v %v", doubled, *e1, batch, *e2)
+				}
+				if e, ok := (*e3).(*common.Error); !ok || e.Code != common.MethodNotFound {
+					t.Errorf("missing method in batch: %v", *e3)
+				}
+			})
+		}
+	}
+}
+
+// 流式分片使用连接的编码推送
+func TestCodecStream(t *testing.T) {
+	for _, codec := range []common.Codec{common.MsgPack, common.CBOR} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			c := newCodecClient(t, "tcp", startCodecServer(t, "tcp", codec), codec).(*Tcp)
+			s, err := c.Stream("export.rows", &rowsArgs{N: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows := readRows(t, s); s.Err() != nil || s.Count() != 3 || len(rows) != 3 || rows[2] != 2 {
+				t.Fatalf("rows %v count %d err %v", rows, s.Count(), s.Err())
+			}
+		})
+	}
+}
+
+// http 服务端按 Content-Type 解析请求，响应使用相同的编码，二进制数据编码为 bin
+func TestHttpContentTypeNegotiation(t *testing.T) {
+	addr := startCodecServer(t, "http", nil)
+	body, err := msgpack.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      7,
+		"method":  "blob.echo",
+		"params":  map[string]interface{}{"data": []byte{0, 0xff}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post("http://"+addr, "application/msgpack", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/msgpack" {
+		t.Fatalf("content type %q", ct)
+	}
+	var res struct {
+		Id     int8                   `msgpack:"id"`
+		Result map[string]interface{} `msgpack:"result"`
+		Error  interface{}            `msgpack:"error"`
+	}
+	if err = msgpack.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Id != 7 || res.Error != nil {
+		t.Fatalf("response %+v", res)
+	}
+	if data, ok := res.Result["data"].([]byte); !ok || !bytes.Equal(data, []byte{0, 0xff}) {
+		t.Errorf("data %#v, want bin 00ff", res.Result["data"])
+	}
+}
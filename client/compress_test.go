@@ -0,0 +1,163 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/server"
+)
+
+// startCompressServer 启动开启压缩的服务端，tcp 协议使用长度检测协议
+func startCompressServer(t *testing.T, protocol string, compressor common.Compressor, maxLength int64) string {
+	t.Helper()
+	port := freePort(t)
+	var svr *common.Server
+	var start func()
+	var shutdown func(ctx context.Context) error
+	if protocol == "tcp" {
+		s := server.NewTcpServer("127.0.0.1", port)
+		options := s.Options
+		options.PackageLengthCheck, options.Compressor, options.PackageMaxLength = true, compressor, maxLength
+		s.SetOptions(options)
+		svr, start, shutdown = &s.Server, s.Start, s.Shutdown
+	} else {
+		// http 服务端按请求头协商压缩算法
+		s := server.NewHttpServer("127.0.0.1", port)
+		options := s.Options
+		options.PackageMaxLength = maxLength
+		s.SetOptions(options)
+		svr, start, shutdown = &s.Server, s.Start, s.Shutdown
+	}
+	if err := svr.RegisterName("blob", blobService{}); err != nil {
+		t.Fatal(err)
+	}
+	go start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = shutdown(ctx)
+	})
+	addr := net.JoinHostPort("127.0.0.1", port)
+	waitListening(t, addr)
+	return addr
+}
+
+func newCompressClient(t *testing.T, protocol string, addr string, compressor common.Compressor) codecClient {
+	t.Helper()
+	ip, port, _ := net.SplitHostPort(addr)
+	if protocol == "tcp" {
+		c := dialTcp(t, addr)
+		options := c.Options
+		options.PackageLengthCheck, options.Compressor = true, compressor
+		c.SetOptions(options)
+		return c
+	}
+	c := NewHttpClient(ip, port)
+	options := c.Options
+	options.Compressor = compressor
+	c.SetOptions(options)
+	return c
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	small := &blobArgs{Data: []byte("small")}
+	large := &blobArgs{Data: bytes.Repeat([]byte("goframe-jsonrpc "), 1024)}
+	for _, compressor := range []common.Compressor{common.Gzip, common.Zstd} {
+		for _, protocol := range []string{"http", "tcp"} {
+			t.Run(compressor.Name()+"/"+protocol, func(t *testing.T) {
+				addr := startCompressServer(t, protocol, compressor, 1024*1024*2)
+				c := newCompressClient(t, protocol, addr, compressor)
+				for _, args := range []*blobArgs{small, large} {
+					var res blobResult
+					if err := c.Call("blob.echo", args, &res, false); err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(res.Data, args.Data) {
+						t.Errorf("echo %d bytes, want %d", len(res.Data), len(args.Data))
+					}
+				}
+			})
+		}
+	}
+}
+
+// http 服务端只压缩达到阈值的响应，按 Accept-Encoding 选择算法
+func TestHttpCompressNegotiation(t *testing.T) {
+	addr := startCompressServer(t, "http", nil, 1024*1024*2)
+	post := func(data []byte, accept string) *http.Response {
+		t.Helper()
+		body := `{"jsonrpc":"2.0","method":"blob.echo","params":{"data":"` + string(data) + `"},"id":"1"}`
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Encoding", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+	large := []byte(strings.Repeat("QUJD", 1024))
+	tests := []struct {
+		data   []byte
+		accept string
+		want   string
+	}{
+		{[]byte("QUJD"), "zstd, gzip", ""},
+		{large, "zstd, gzip", "zstd"},
+		{large, "gzip", "gzip"},
+		{large, "zstd;q=0, gzip", "gzip"},
+		{large, "br", ""},
+	}
+	for _, tt := range tests {
+		if got := post(tt.data, tt.accept).Header.Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%d bytes, Accept-Encoding %q: Content-Encoding = %q, want %q", len(tt.data), tt.accept, got, tt.want)
+		}
+	}
+}
+
+// 解压后超过 PackageMaxLength 的请求与响应都被拒绝
+func TestCompressMaxLength(t *testing.T) {
+	large := &blobArgs{Data: bytes.Repeat([]byte("a"), 64*1024)}
+	for _, protocol := range []string{"http", "tcp"} {
+		t.Run(protocol+"/request", func(t *testing.T) {
+			addr := startCompressServer(t, protocol, common.Zstd, 16*1024)
+			c := newCompressClient(t, protocol, addr, common.Zstd)
+			var res blobResult
+			err := c.Call("blob.echo", large, &res, false)
+			if err == nil {
+				t.Fatal("want error for oversized request")
+			}
+			if e, ok := err.(*common.Error); protocol == "http" && (!ok || e.Code != common.ParseError) {
+				t.Errorf("http error = %v, want ParseError", err)
+			}
+		})
+	}
+
+	t.Run("http/response", func(t *testing.T) {
+		addr := startCompressServer(t, "http", nil, 1024*1024*2)
+		ip, port, _ := net.SplitHostPort(addr)
+		c := NewHttpClient(ip, port)
+		options := c.Options
+		options.PackageMaxLength = 16 * 1024
+		c.SetOptions(options)
+		var res blobResult
+		err := c.Call("blob.echo", large, &res, false)
+		if err == nil || !strings.Contains(err.Error(), "超过限制") {
+			t.Errorf("error = %v, want limit exceeded", err)
+		}
+
+		// 未超过限制时正常解压
+		options.PackageMaxLength = 1024 * 1024
+		c.SetOptions(options)
+		if err = c.Call("blob.echo", large, &res, false); err != nil || res.Len != len(large.Data) {
+			t.Errorf("echo = %d, %v", res.Len, err)
+		}
+	})
+}
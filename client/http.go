@@ -2,20 +2,47 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
 
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type Http struct {
 	Ip          string
 	Port        string
 	RequestList []*common.SingleRequest
+	Options     HttpOptions
+
+	authorization string // Authenticate 设置的认证信息
+}
+
+type HttpOptions struct {
+	Codec              common.Codec      // 消息编码，默认为 json，通过 Content-Type 告知服务端
+	Compressor         common.Compressor // 请求体压缩算法，为 nil 时不压缩请求体，需要服务端支持
+	CompressThreshold  int               // 压缩阈值，小于该长度的请求体不压缩，不大于 0 时使用 common.DefaultCompressThreshold
+	DisableCompression bool              // 不通过 Accept-Encoding 请求压缩的响应
+	PackageMaxLength   int64             // 响应体解压后的最大长度，不大于 0 时不限制
+
+	// Credentials 按请求体生成 Authorization 请求头，用于 HMAC 签名等需要覆盖请求体的认证方式，优先于 Authenticate 设置的认证信息
+	//	Credentials: func(body []byte) string { return common.HMACCredentials("app1", secret, body) }
+	Credentials func(body []byte) string
+
+	Signer  *common.Signer        // 请求签名，为请求体中的每个请求添加 sign 字段
+	Metrics *common.ClientMetrics // 客户端指标，通过 common.NewClientMetrics 创建，为 nil 时不记录
+	Tracing *common.Tracing       // 链路追踪，通过 common.NewTracing 创建，trace context 通过请求头传递，为 nil 时不记录
+	Log     *common.LogOptions    // 访问日志，为 nil 时不输出
+	Retry   *common.RetryPolicy   // 重试策略，只重试幂等方法，为 nil 时不重试
+	Breaker *Breaker              // 熔断器，通过 NewBreaker 创建，打开时直接返回 ErrCircuitOpen，为 nil 时不熔断
 }
 
 // NewHttpClient 实例化客户端对象
@@ -24,11 +51,14 @@ func NewHttpClient(ip string, port string) *Http {
 		Ip:          ip,
 		Port:        port,
 		RequestList: nil,
+		Options: HttpOptions{
+			PackageMaxLength: 1024 * 1024 * 2,
+		},
 	}
 }
 
 func (p *Http) SetOptions(httpOptions interface{}) {
-
+	p.Options = httpOptions.(HttpOptions)
 }
 
 // BatchAppend 批量追加
@@ -45,11 +75,23 @@ func (p *Http) BatchAppend(method string, params interface{}, result interface{}
 
 // BatchCall 批量调用
 func (p *Http) BatchCall() error {
+	return p.BatchCallContext(context.Background())
+}
+
+// BatchCallContext 携带上下文批量调用，开启链路追踪时以 ctx 中的 span 为父节点
+func (p *Http) BatchCallContext(ctx context.Context) error {
+	list := p.RequestList
+	p.RequestList = make([]*common.SingleRequest, 0)
+	return p.batchCall(ctx, list)
+}
+
+// batchCall 发送批量请求，不使用 RequestList，负载均衡客户端可以在多个协程中共用同一个客户端
+func (p *Http) batchCall(ctx context.Context, list []*common.SingleRequest) error {
 	var (
 		err error
 		br  []interface{}
 	)
-	for _, v := range p.RequestList {
+	for _, v := range list {
 		var req interface{}
 		if v.IsNotify == true {
 			req = common.Rs(nil, v.Method, v.Params)
@@ -58,41 +100,150 @@ func (p *Http) BatchCall() error {
 		}
 		br = append(br, req)
 	}
-	bReq := common.JsonBatchRs(br)
-	err = p.handleFunc(bReq, p.RequestList)
-	p.RequestList = make([]*common.SingleRequest, 0)
+	methods := batchMethods(list)
+	ctx, span := p.Options.Tracing.StartClient(ctx, methods...)
+	start := time.Now()
+	done := p.Options.Metrics.Begin(methods...)
+	retry := p.Options.Retry
+	for _, v := range list {
+		if v.IsNotify {
+			retry = nil
+		}
+	}
+	err = retry.DoBatch(ctx, methods, func(attempt int) error {
+		if attempt > 1 {
+			retried(p.Options.Metrics, span, common.BatchMethod, attempt)
+			resetErrors(list)
+		}
+		return p.Options.Breaker.Do(net.JoinHostPort(p.Ip, p.Port), common.BatchMethod, func() error {
+			return p.handleFunc(ctx, br, list)
+		})
+	})
+	errs := batchErrors(list, err)
+	done(errs...)
+	common.EndSpan(span, err)
+	for i, v := range list {
+		p.Options.Log.ClientLog(ctx, net.JoinHostPort(p.Ip, p.Port), v.Method, v.Params, i, time.Since(start), errs[i])
+	}
 	return err
 }
 
 func (p *Http) Call(method string, params interface{}, result interface{}, isNotify bool) error {
+	return p.CallContext(context.Background(), method, params, result, isNotify)
+}
+
+// CallContext 携带上下文调用，开启链路追踪时以 ctx 中的 span 为父节点
+func (p *Http) CallContext(ctx context.Context, method string, params interface{}, result interface{}, isNotify bool) error {
 	var (
 		err error
-		req []byte
+		req interface{}
 	)
 
 	if isNotify {
-		req = common.JsonRs(nil, method, params)
+		req = common.Rs(nil, method, params)
 	} else {
-		req = common.JsonRs(strconv.FormatInt(time.Now().Unix(), 10), method, params)
+		req = common.Rs(strconv.FormatInt(time.Now().Unix(), 10), method, params)
+	}
+	ctx, span := p.Options.Tracing.StartClient(ctx, method)
+	start := time.Now()
+	done := p.Options.Metrics.Begin(method)
+	// 通知请求没有响应，无法确认是否已执行，不重试
+	retry := p.Options.Retry
+	if isNotify {
+		retry = nil
 	}
-	err = p.handleFunc(req, result)
+	err = retry.Do(ctx, method, func(attempt int) error {
+		if attempt > 1 {
+			retried(p.Options.Metrics, span, method, attempt)
+		}
+		return p.Options.Breaker.Do(net.JoinHostPort(p.Ip, p.Port), method, func() error {
+			return p.handleFunc(ctx, req, result)
+		})
+	})
+	done(err)
+	common.EndSpan(span, err)
+	p.Options.Log.ClientLog(ctx, net.JoinHostPort(p.Ip, p.Port), method, params, -1, time.Since(start), err)
 	return err
 }
 
-func (p *Http) handleFunc(b []byte, result interface{}) error {
+// Authenticate 设置认证信息，之后的请求通过 Authorization 请求头发送
+func (p *Http) Authenticate(authorization string) error {
+	p.authorization = authorization
+	return nil
+}
+
+// Stream http 协议无法推送分片，流式方法请使用 tcp 协议调用
+func (p *Http) Stream(method string, params interface{}) (*Stream, error) {
+	return nil, errors.New("rpc: http 协议不支持流式调用")
+}
+
+func (p *Http) handleFunc(ctx context.Context, body interface{}, result interface{}) error {
 	var url = fmt.Sprintf("http://%s:%s", p.Ip, p.Port)
-	// 发送 POST 请求
-	resp, err := http.Post(url, "application/json", bytes.NewReader(b)) //缓冲器 从一个[]byte切片，构造一个Buffer
+	codec := p.Options.Codec
+	if codec == nil {
+		codec = common.JSON
+	}
+	// 按配置的编码直接序列化请求，trace context 通过请求头传递
+	b, err := common.EncodeRequest(ctx, codec, body, p.Options.Signer, nil)
+	if err != nil {
+		return err
+	}
+	authorization := p.authorization
+	if p.Options.Credentials != nil {
+		// 签名覆盖编码后、压缩前的请求体
+		authorization = p.Options.Credentials(b)
+	}
+	var encoding string
+	if c := p.Options.Compressor; c != nil && len(b) >= common.CompressThreshold(p.Options.CompressThreshold) {
+		if b, err = c.Compress(b); err != nil {
+			return err
+		}
+		encoding = c.Name()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b)) //缓冲器 从一个[]byte切片，构造一个Buffer
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", codec.ContentType())
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	p.Options.Tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if !p.Options.DisableCompression {
+		// 手动设置 Accept-Encoding 后 net/http 不再自动解压，由下方按 Content-Encoding 解压
+		req.Header.Set("Accept-Encoding", common.AcceptEncoding())
+	}
+	// 发送 POST 请求
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return &common.TransportError{Err: err}
+	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
-	body, err := ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return &common.TransportError{Err: err}
+	}
+	if resp.StatusCode != http.StatusOK && len(data) == 0 {
+		return &common.TransportError{Err: fmt.Errorf("rpc: http 请求失败 %s", resp.Status)}
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		c, ok := common.GetCompressor(encoding)
+		if !ok {
+			return fmt.Errorf("rpc: 不支持的压缩算法 %s", encoding)
+		}
+		if data, err = c.Decompress(data, p.Options.PackageMaxLength); err != nil {
+			return err
+		}
+	}
+	// 按响应头 Content-Type 解码，无法识别时使用请求的编码
+	if c, ok := common.GetCodec(resp.Header.Get("Content-Type")); ok {
+		codec = c
 	}
-	err = common.GetResult(body, result)
+	err = common.DecodeResult(codec, data, result)
 	return err
 }
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchMethods 批量请求中每个元素的方法名
+func batchMethods(list []*common.SingleRequest) []string {
+	methods := make([]string, len(list))
+	for i, v := range list {
+		methods[i] = v.Method
+	}
+	return methods
+}
+
+// batchErrors 批量请求中每个元素的错误，整个批量请求失败时所有元素使用同一个错误
+func batchErrors(list []*common.SingleRequest, err error) []error {
+	errs := make([]error, len(list))
+	for i, v := range list {
+		switch {
+		case err != nil:
+			errs[i] = err
+		case v.Error != nil:
+			errs[i] = *v.Error
+		}
+	}
+	return errs
+}
+
+// retried 重试时记录指标并在 span 中添加 retry 事件
+func retried(m *common.ClientMetrics, span trace.Span, method string, attempt int) {
+	m.Retried(method)
+	span.AddEvent("retry", trace.WithAttributes(attribute.Int("rpc.retry.attempt", attempt)))
+}
+
+// resetErrors 重试批量请求前清空上一次的错误
+func resetErrors(list []*common.SingleRequest) {
+	for _, v := range list {
+		if v.Error != nil {
+			*v.Error = nil
+		}
+	}
+}
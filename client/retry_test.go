@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+// startFlakyServer 启动按 respond 返回响应的 http 服务，返回服务地址与收到的请求数
+func startFlakyServer(t *testing.T, respond func(w http.ResponseWriter)) (string, string, *int32) {
+	t.Helper()
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		respond(w)
+	}))
+	t.Cleanup(ts.Close)
+	u, _ := url.Parse(ts.URL)
+	ip, port, _ := net.SplitHostPort(u.Host)
+	return ip, port, &calls
+}
+
+func newRetryClient(ip string, port string, delays *[]time.Duration) *Http {
+	c := NewHttpClient(ip, port)
+	options := c.Options
+	options.Retry = &common.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Idempotent:     []string{"blob.*"},
+		OnRetry: func(ctx context.Context, method string, attempt int, err error, delay time.Duration) {
+			*delays = append(*delays, delay)
+		},
+	}
+	c.SetOptions(options)
+	return c
+}
+
+func TestHttpRetry(t *testing.T) {
+	unavailable := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	t.Run("transport error", func(t *testing.T) {
+		ip, port, calls := startFlakyServer(t, unavailable)
+		var delays []time.Duration
+		c := newRetryClient(ip, port, &delays)
+		if err := c.Call("blob.echo", &blobArgs{}, &blobResult{}, false); err == nil {
+			t.Fatal("want error")
+		}
+		if atomic.LoadInt32(calls) != 3 || len(delays) != 2 || delays[1] != 2*time.Millisecond {
+			t.Errorf("calls = %d, delays = %v", atomic.LoadInt32(calls), delays)
+		}
+	})
+
+	// 通知请求没有响应，无法确认是否已执行，不重试
+	t.Run("notification", func(t *testing.T) {
+		ip, port, calls := startFlakyServer(t, unavailable)
+		var delays []time.Duration
+		c := newRetryClient(ip, port, &delays)
+		_ = c.Call("blob.echo", &blobArgs{}, nil, true)
+		var result blobResult
+		list := []*common.SingleRequest{
+			{Method: "blob.echo", Params: &blobArgs{}, Result: &result, Error: new(error)},
+			{Method: "blob.echo", Params: &blobArgs{}, IsNotify: true, Error: new(error)},
+		}
+		_ = c.batchCall(context.Background(), list)
+		if atomic.LoadInt32(calls) != 2 || len(delays) != 0 {
+			t.Errorf("calls = %d, delays = %v", atomic.LoadInt32(calls), delays)
+		}
+	})
+
+	// 限流时按服务端返回的 retryAfter 等待
+	t.Run("retry after", func(t *testing.T) {
+		ip, port, calls := startFlakyServer(t, func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":"1","error":{"code":-32001,"message":"请求过于频繁","data":{"retryAfter":0.05}}}`))
+		})
+		var delays []time.Duration
+		c := newRetryClient(ip, port, &delays)
+		err := c.Call("blob.echo", &blobArgs{}, &blobResult{}, false)
+		if e, ok := err.(*common.Error); !ok || e.Code != common.RateLimited {
+			t.Fatalf("error = %v", err)
+		}
+		if atomic.LoadInt32(calls) != 3 || len(delays) != 2 || delays[0] != 50*time.Millisecond || delays[1] != 50*time.Millisecond {
+			t.Errorf("calls = %d, delays = %v", atomic.LoadInt32(calls), delays)
+		}
+	})
+
+	// 等待重试时 ctx 取消立即返回
+	t.Run("context canceled", func(t *testing.T) {
+		ip, port, calls := startFlakyServer(t, unavailable)
+		var delays []time.Duration
+		c := newRetryClient(ip, port, &delays)
+		c.Options.Retry.InitialBackoff = 10 * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := c.CallContext(ctx, "blob.echo", &blobArgs{}, &blobResult{}, false); err == nil {
+			t.Fatal("want error")
+		}
+		if d := time.Since(start); d > time.Second || atomic.LoadInt32(calls) != 1 {
+			t.Errorf("returned after %v with %d calls", d, atomic.LoadInt32(calls))
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+
+	"errors"
+)
+
+var errStreamClosed = errors.New("rpc: 流已关闭")
+
+// Stream 流式调用的结果迭代器
+//
+//	s, err := c.Stream("report/export", &params)
+//	for s.Next() {
+//		var row Row
+//		_ = s.Scan(&row)
+//	}
+//	err = s.Err()
+type Stream struct {
+	id    string
+	codec common.RawCodec
+	read  func() ([]byte, error)
+	data  []byte
+	index int
+	end   common.StreamEnd
+	err   error
+	done  bool
+
+	bridge   common.Codec // 未实现 RawCodec 的编码，读取后先转换为 json
+	onFinish func()       // 流结束时调用，负载均衡客户端用于关闭流使用的连接
+}
+
+// streamFrame 流式调用过程中服务端下发的消息，可能是分片通知也可能是最终响应
+type streamFrame struct {
+	Id     *string
+	Method string
+	Params []byte
+	Result []byte
+	Error  *common.Error
+}
+
+func newStream(id string, codec common.Codec, read func() ([]byte, error)) *Stream {
+	s := &Stream{id: id, read: read}
+	rc, ok := common.AsRawCodec(codec)
+	if !ok {
+		s.bridge, rc = codec, common.JSON.(common.RawCodec)
+	}
+	s.codec = rc
+	return s
+}
+
+// Next 读取下一个分片，收到最终响应或出现错误时返回 false
+func (s *Stream) Next() bool {
+	for !s.done {
+		f, err := s.readFrame()
+		if err != nil {
+			s.finish(err)
+			break
+		}
+		// 分片通知，忽略不属于当前请求的消息
+		if f.Method == common.StreamMethod && f.Params != nil {
+			var (
+				id    string
+				index int
+			)
+			fields, err := s.codec.UnmarshalObject(f.Params)
+			if err == nil {
+				_ = s.codec.Unmarshal(fields["id"], &id)
+				err = s.codec.Unmarshal(fields["index"], &index)
+			}
+			if err != nil {
+				s.finish(err)
+				break
+			}
+			if id != s.id {
+				continue
+			}
+			s.data = fields["data"]
+			s.index = index
+			return true
+		}
+		if f.Id == nil || *f.Id != s.id {
+			continue
+		}
+		// 最终响应，标记流结束
+		if f.Error != nil {
+			s.finish(errors.New(f.Error.Message))
+			break
+		}
+		if f.Result != nil {
+			if err = s.codec.Unmarshal(f.Result, &s.end); err != nil {
+				s.finish(err)
+				break
+			}
+		}
+		s.finish(nil)
+	}
+	return false
+}
+
+// readFrame 读取一条消息，按编码解析协议字段，params 与 result 保持原始数据
+func (s *Stream) readFrame() (*streamFrame, error) {
+	b, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if s.bridge != nil {
+		if b, err = common.ToJSON(s.bridge, b); err != nil {
+			return nil, err
+		}
+	}
+	fields, err := s.codec.UnmarshalObject(b)
+	if err != nil {
+		return nil, err
+	}
+	f := &streamFrame{Params: fields["params"], Result: fields["result"]}
+	for name, v := range map[string]interface{}{"id": &f.Id, "method": &f.Method, "error": &f.Error} {
+		if raw, ok := fields[name]; ok {
+			if err = s.codec.Unmarshal(raw, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+// Scan 将当前分片解析到 v 中
+func (s *Stream) Scan(v interface{}) error {
+	if s.data == nil {
+		return errors.New("rpc: 当前没有可读取的分片")
+	}
+	return s.codec.Unmarshal(s.data, v)
+}
+
+// Index 当前分片的序号
+func (s *Stream) Index() int {
+	return s.index
+}
+
+// Count 服务端推送的分片总数，流结束后有效
+func (s *Stream) Count() int {
+	return s.end.Count
+}
+
+// Close 提前结束读取，流已结束时不做任何操作
+// 负载均衡客户端返回的流同时关闭使用的连接，直接使用 Tcp 客户端时下一次请求重新建立连接
+func (s *Stream) Close() error {
+	if !s.done {
+		s.finish(errStreamClosed)
+	}
+	return nil
+}
+
+// Err 流结束的原因，正常结束时返回 nil
+func (s *Stream) Err() error {
+	return s.err
+}
+
+func (s *Stream) finish(err error) {
+	s.done = true
+	s.data = nil
+	s.err = err
+	if s.onFinish != nil {
+		s.onFinish()
+		s.onFinish = nil
+	}
+}
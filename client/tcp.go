@@ -1,10 +1,9 @@
 package client
 
 import (
+	"context"
 	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
 
-	"bytes"
-	"fmt"
 	"net"
 	"strconv"
 	"time"
@@ -16,11 +15,25 @@ type Tcp struct {
 	RequestList []*common.SingleRequest
 	Options     TcpOptions
 	Conn        net.Conn
+	framer      *common.Framer // 按配置的协议拆分响应消息
+
+	broken        bool   // 连接读写失败，下一次请求前重新建立连接
+	authorization string // Authenticate 设置的认证信息，重新建立连接后重新握手
 }
 
 type TcpOptions struct {
-	PackageEof       string
-	PackageMaxLength int64
+	PackageEof         string
+	PackageMaxLength   int64
+	PackageLengthCheck bool                  // 使用 4 字节包头的长度检测协议，需要与服务端一致，二进制编码必须开启
+	Codec              common.Codec          // 消息编码，默认为 json，需要与服务端一致
+	Compressor         common.Compressor     // 压缩算法，需要开启 PackageLengthCheck，需要与服务端一致
+	CompressThreshold  int                   // 压缩阈值，小于该长度的消息不压缩，不大于 0 时使用 common.DefaultCompressThreshold
+	Signer             *common.Signer        // 请求签名，为每个请求添加 sign 字段
+	Metrics            *common.ClientMetrics // 客户端指标，通过 common.NewClientMetrics 创建，为 nil 时不记录
+	Tracing            *common.Tracing       // 链路追踪，通过 common.NewTracing 创建，trace context 通过请求的 trace 字段传递，为 nil 时不记录
+	Log                *common.LogOptions    // 访问日志，为 nil 时不输出
+	Retry              *common.RetryPolicy   // 重试策略，只重试幂等方法，网络错误时重新建立连接，为 nil 时不重试
+	Breaker            *Breaker              // 熔断器，通过 NewBreaker 创建，打开时直接返回 ErrCircuitOpen，为 nil 时不熔断
 }
 
 func NewTcpClient(ip string, port string) (*Tcp, error) {
@@ -29,7 +42,7 @@ func NewTcpClient(ip string, port string) (*Tcp, error) {
 		PackageMaxLength: 1024 * 1024 * 2,
 	}
 
-	var addr = fmt.Sprintf("%s:%s", ip, port)
+	var addr = net.JoinHostPort(ip, port)
 	// 建立 tcp 连接
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
@@ -57,11 +70,23 @@ func (p *Tcp) BatchAppend(method string, params interface{}, result interface{},
 }
 
 func (p *Tcp) BatchCall() error {
+	return p.BatchCallContext(context.Background())
+}
+
+// BatchCallContext 携带上下文批量调用，开启链路追踪时以 ctx 中的 span 为父节点
+func (p *Tcp) BatchCallContext(ctx context.Context) error {
+	list := p.RequestList
+	p.RequestList = make([]*common.SingleRequest, 0)
+	return p.batchCall(ctx, list)
+}
+
+// batchCall 发送批量请求，不使用 RequestList，负载均衡客户端可以在多个协程中共用同一个客户端
+func (p *Tcp) batchCall(ctx context.Context, list []*common.SingleRequest) error {
 	var (
 		err error
 		br  []interface{}
 	)
-	for _, v := range p.RequestList {
+	for _, v := range list {
 		var req interface{}
 		if v.IsNotify == true {
 			req = common.Rs(nil, v.Method, v.Params)
@@ -70,57 +95,179 @@ func (p *Tcp) BatchCall() error {
 		}
 		br = append(br, req)
 	}
-	bReq := common.JsonBatchRs(br)
-	bReq = append(bReq, []byte(p.Options.PackageEof)...)
-	err = p.handleFunc(bReq, p.RequestList)
-	p.RequestList = make([]*common.SingleRequest, 0)
+	methods := batchMethods(list)
+	ctx, span := p.Options.Tracing.StartClient(ctx, methods...)
+	start := time.Now()
+	done := p.Options.Metrics.Begin(methods...)
+	retry := p.Options.Retry
+	for _, v := range list {
+		if v.IsNotify {
+			retry = nil
+		}
+	}
+	err = retry.DoBatch(ctx, methods, func(attempt int) error {
+		if attempt > 1 {
+			retried(p.Options.Metrics, span, common.BatchMethod, attempt)
+			resetErrors(list)
+		}
+		return p.Options.Breaker.Do(net.JoinHostPort(p.Ip, p.Port), common.BatchMethod, func() error {
+			return p.handleFunc(ctx, br, list)
+		})
+	})
+	errs := batchErrors(list, err)
+	done(errs...)
+	common.EndSpan(span, err)
+	for i, v := range list {
+		p.Options.Log.ClientLog(ctx, net.JoinHostPort(p.Ip, p.Port), v.Method, v.Params, i, time.Since(start), errs[i])
+	}
 	return err
 }
 
 func (p *Tcp) SetOptions(tcpOptions interface{}) {
 	p.Options = tcpOptions.(TcpOptions)
+	p.framer = nil
 }
 
 func (p *Tcp) Call(method string, params interface{}, result interface{}, isNotify bool) error {
+	return p.CallContext(context.Background(), method, params, result, isNotify)
+}
+
+// CallContext 携带上下文调用，开启链路追踪时以 ctx 中的 span 为父节点
+func (p *Tcp) CallContext(ctx context.Context, method string, params interface{}, result interface{}, isNotify bool) error {
 	var (
 		err error
-		req []byte
+		req interface{}
 	)
 	if isNotify {
-		req = common.JsonRs(nil, method, params)
+		req = common.Rs(nil, method, params)
 	} else {
-		req = common.JsonRs(strconv.FormatInt(time.Now().Unix(), 10), method, params)
+		req = common.Rs(strconv.FormatInt(time.Now().Unix(), 10), method, params)
+	}
+	ctx, span := p.Options.Tracing.StartClient(ctx, method)
+	start := time.Now()
+	done := p.Options.Metrics.Begin(method)
+	// 通知请求没有响应，无法确认是否已执行，不重试
+	retry := p.Options.Retry
+	if isNotify {
+		retry = nil
 	}
-	req = append(req, []byte(p.Options.PackageEof)...)
-	err = p.handleFunc(req, result)
+	err = retry.Do(ctx, method, func(attempt int) error {
+		if attempt > 1 {
+			retried(p.Options.Metrics, span, method, attempt)
+		}
+		return p.Options.Breaker.Do(net.JoinHostPort(p.Ip, p.Port), method, func() error {
+			return p.handleFunc(ctx, req, result)
+		})
+	})
+	done(err)
+	common.EndSpan(span, err)
+	p.Options.Log.ClientLog(ctx, net.JoinHostPort(p.Ip, p.Port), method, params, -1, time.Since(start), err)
 	return err
 }
 
-func (p *Tcp) handleFunc(b []byte, result interface{}) error {
-	var err error
-	_, err = p.Conn.Write(b)
+// Authenticate 通过 rpc.auth 握手认证当前连接，之后该连接上的请求都使用认证后的身份
+func (p *Tcp) Authenticate(authorization string) error {
+	p.authorization = authorization
+	return p.Call(common.AuthMethod, map[string]string{"authorization": authorization}, nil, false)
+}
+
+// Close 关闭连接
+func (p *Tcp) Close() error {
+	return p.Conn.Close()
+}
+
+// reconnect 重新建立连接，设置过认证信息时重新握手
+func (p *Tcp) reconnect(ctx context.Context) error {
+	_ = p.Conn.Close()
+	conn, err := net.Dial("tcp", net.JoinHostPort(p.Ip, p.Port))
 	if err != nil {
-		return err
+		return &common.TransportError{Err: err}
 	}
-	eofb := []byte(p.Options.PackageEof)
-	eofl := len(eofb)
-	var data []byte
-	l := 0
-	for {
-		var buf = make([]byte, p.Options.PackageMaxLength)
-		n, err := p.Conn.Read(buf)
-		if err != nil {
-			if n == 0 {
-				return err
-			}
-			common.Debug(err.Error())
-		}
-		l += n
-		data = append(data, buf[:n]...)
-		if bytes.Equal(data[l-eofl:], eofb) {
-			break
+	p.Conn, p.framer, p.broken = conn, nil, false
+	if p.authorization == "" {
+		return nil
+	}
+	return p.handleFunc(ctx, common.Rs(strconv.FormatInt(time.Now().Unix(), 10), common.AuthMethod, map[string]string{"authorization": p.authorization}), nil)
+}
+
+// Stream 调用流式方法，返回的迭代器读取完毕前不能在同一连接上发起其它请求
+func (p *Tcp) Stream(method string, params interface{}) (*Stream, error) {
+	return p.StreamContext(context.Background(), method, params)
+}
+
+// StreamContext 携带上下文调用流式方法，开启链路追踪时 trace context 随请求发送
+func (p *Tcp) StreamContext(ctx context.Context, method string, params interface{}) (*Stream, error) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := p.send(ctx, common.Rs(id, method, params)); err != nil {
+		return nil, err
+	}
+	s := newStream(id, p.Options.Codec, p.read)
+	// 提前结束时连接上仍有未读取的分片，下一次请求重新建立连接
+	s.onFinish = func() {
+		if s.err == errStreamClosed {
+			p.broken = true
 		}
 	}
-	err = common.GetResult(data[:l-eofl], result)
+	return s, nil
+}
+
+func (p *Tcp) handleFunc(ctx context.Context, body interface{}, result interface{}) error {
+	if err := p.send(ctx, body); err != nil {
+		return err
+	}
+	data, err := p.read()
+	if err != nil {
+		return err
+	}
+	err = common.DecodeResult(p.Options.Codec, data, result)
 	return err
 }
+
+// send 连接读写失败过时先重新建立连接，按配置的编码序列化请求，添加签名与 trace context 后发送
+func (p *Tcp) send(ctx context.Context, body interface{}) error {
+	if p.broken {
+		if err := p.reconnect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := common.CheckFraming(p.Options.Codec, p.Options.Compressor, p.Options.PackageLengthCheck); err != nil {
+		return err
+	}
+	b, err := common.EncodeRequest(ctx, p.Options.Codec, body, p.Options.Signer, p.Options.Tracing)
+	if err != nil {
+		return err
+	}
+	return p.write(b)
+}
+
+// write 按配置的协议封装请求后发送
+func (p *Tcp) write(b []byte) error {
+	b, err := p.getFramer().Pack(b)
+	if err != nil {
+		return err
+	}
+	if _, err = p.Conn.Write(b); err != nil {
+		p.broken = true
+		return &common.TransportError{Err: err}
+	}
+	return nil
+}
+
+// read 读取一条完整的消息，多读取的数据保留到下一次读取
+func (p *Tcp) read() ([]byte, error) {
+	data, err := p.getFramer().ReadFrame()
+	if err != nil {
+		p.broken = true
+		return nil, &common.TransportError{Err: err}
+	}
+	return data, nil
+}
+
+// getFramer 按当前配置创建消息拆分器，SetOptions 后重新创建
+func (p *Tcp) getFramer() *common.Framer {
+	if p.framer == nil {
+		p.framer = common.NewFramer(p.Conn, p.Options.PackageEof, p.Options.PackageLengthCheck, p.Options.PackageMaxLength)
+		p.framer.SetCompressor(p.Options.Compressor, common.CompressThreshold(p.Options.CompressThreshold))
+	}
+	return p.framer
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracing() (*common.Tracing, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return common.NewTracing(provider, nil), exporter
+}
+
+func dialTcp(t *testing.T, addr string) *Tcp {
+	t.Helper()
+	ip, port, _ := net.SplitHostPort(addr)
+	c, err := NewTcpClient(ip, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func readRows(t *testing.T, s *Stream) []int {
+	t.Helper()
+	var rows []int
+	for s.Next() {
+		var row int
+		if err := s.Scan(&row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// 提前关闭流后连接上仍有未读取的分片，之后的流式调用与普通调用重新建立连接
+func TestTcpStreamCloseReconnects(t *testing.T) {
+	c := dialTcp(t, startServer(t, "tcp"))
+
+	s, err := c.Stream("export.rows", &rowsArgs{N: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Next() {
+		t.Fatalf("first chunk: %v", s.Err())
+	}
+	_ = s.Close()
+	if !c.broken {
+		t.Fatal("connection with unread chunks not marked broken")
+	}
+	closed := c.Conn
+
+	s, err = c.Stream("export.rows", &rowsArgs{N: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Conn == closed {
+		t.Error("stream reused the connection with unread chunks")
+	}
+	if rows := readRows(t, s); s.Err() != nil || s.Count() != 3 || len(rows) != 3 || rows[0] != 0 {
+		t.Fatalf("stream after close: rows %v count %d err %v", rows, s.Count(), s.Err())
+	}
+
+	var doubled int
+	if err = c.Call("export.double", &rowsArgs{N: 21}, &doubled, false); err != nil || doubled != 42 {
+		t.Fatalf("call after stream: %d %v", doubled, err)
+	}
+}
+
+// 流式调用与普通调用一样通过请求的 trace 字段传递 trace context
+func TestTcpStreamInjectsTrace(t *testing.T) {
+	serverTracing, exporter := newTestTracing()
+	c := dialTcp(t, startServer(t, "tcp", func(svr *common.Server) { svr.SetTracing(serverTracing) }))
+	clientTracing, _ := newTestTracing()
+	c.SetOptions(TcpOptions{PackageEof: "\r\n", PackageMaxLength: 1024 * 1024 * 2, Tracing: clientTracing})
+
+	ctx, span := clientTracing.StartClient(context.Background(), "export.rows")
+	s, err := c.StreamContext(ctx, "export.rows", &rowsArgs{N: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := readRows(t, s); s.Err() != nil || len(rows) != 2 {
+		t.Fatalf("rows %v err %v", rows, s.Err())
+	}
+	span.End()
+
+	deadline := time.Now().Add(time.Second)
+	for len(exporter.GetSpans()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("server exported %d spans, want 1", len(spans))
+	}
+	if got, want := spans[0].Parent.SpanID(), span.SpanContext().SpanID(); got != want {
+		t.Errorf("server span parent %s, want client span %s", got, want)
+	}
+}
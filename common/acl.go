@@ -0,0 +1,148 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/gogf/gf/v2/os/gcfg"
+)
+
+// ACLRule 访问规则，调用方拥有任一角色或授权范围时允许调用匹配的方法
+type ACLRule struct {
+	Methods []string `json:"methods"` // 方法匹配模式 如 user.info、user.*、*.delete、*，支持别名，兼容大驼峰、小驼峰与下划线
+	Roles   []string `json:"roles"`   // 允许的角色，* 表示所有调用方，包括未认证的调用方
+	Scopes  []string `json:"scopes"`  // 允许的授权范围
+}
+
+// ACL 方法级别的访问控制，按顺序使用第一条匹配方法的规则，没有匹配的规则时按 DefaultAllow 处理
+//
+//	s.SetACL(&common.ACL{Rules: []common.ACLRule{
+//		{Methods: []string{"rpc.discover", "user.info"}, Roles: []string{"*"}},
+//		{Methods: []string{"user.*"}, Roles: []string{"admin"}, Scopes: []string{"user:write"}},
+//	}})
+type ACL struct {
+	Rules        []ACLRule `json:"rules"`
+	DefaultAllow bool      `json:"defaultAllow"` // 没有匹配的规则时是否允许调用
+}
+
+// LoadACL 从 goframe 配置文件读取访问控制规则，pattern 为配置项 如 rpc.acl
+//
+//	rpc:
+//	  acl:
+//	    defaultAllow: false
+//	    rules:
+//	      - methods: ["user.*"]
+//	        roles: ["admin"]
+func LoadACL(ctx context.Context, pattern string) (*ACL, error) {
+	v, err := gcfg.Instance().Get(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if v.IsNil() {
+		return nil, fmt.Errorf("rpc: 配置项 %s 不存在", pattern)
+	}
+	acl := &ACL{}
+	if err = v.Scan(acl); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// SetACL 设置访问控制规则，为 nil 时不限制
+func (svr *Server) SetACL(acl *ACL) {
+	svr.acl.Store(aclHolder{acl})
+}
+
+// aclHolder 包装可能为 nil 的访问控制规则，atomic.Value 不能存储 nil
+type aclHolder struct {
+	acl *ACL
+}
+
+// Allow 检测调用方是否可以调用方法，method 为完整的方法名
+func (a *ACL) Allow(p *Principal, method string) bool {
+	return a.allow(p, func(pattern string) bool {
+		return matchMethod(pattern, method)
+	})
+}
+
+// allow 使用第一条匹配方法的规则检测调用方的权限
+func (a *ACL) allow(p *Principal, match func(pattern string) bool) bool {
+	for _, rule := range a.Rules {
+		for _, pattern := range rule.Methods {
+			if match(pattern) {
+				return rule.allow(p)
+			}
+		}
+	}
+	return a.DefaultAllow
+}
+
+func (r *ACLRule) allow(p *Principal) bool {
+	for _, role := range r.Roles {
+		if role == "*" {
+			return true
+		}
+		if p != nil && contains(p.Roles, role) {
+			return true
+		}
+	}
+	for _, scope := range r.Scopes {
+		if p != nil && contains(p.Scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize 按访问控制规则检测当前调用方是否可以调用方法
+func (svr *Server) authorize(ctx context.Context, method string) bool {
+	h, _ := svr.acl.Load().(aclHolder)
+	if h.acl == nil {
+		return true
+	}
+	return h.acl.allow(PrincipalFromContext(ctx), func(pattern string) bool {
+		// 不含通配符的模式与调用时一样解析别名与命名风格，按解析后的方法比较
+		if !strings.ContainsAny(pattern, "*?[") && strings.ContainsAny(pattern, "./") {
+			if svc, m, ok := svr.Lookup(pattern); ok {
+				return svc.Name+"."+m.Name == method
+			}
+		}
+		return matchMethod(pattern, method)
+	})
+}
+
+// matchMethod 按服务名与方法名分别匹配方法模式，支持 path.Match 通配，* 匹配所有方法
+// 大驼峰、小驼峰与下划线转换为大驼峰后比较，user_info 与 userInfo 相同，与 userinfo 不同
+func matchMethod(pattern string, method string) bool {
+	if pattern == "*" {
+		return true
+	}
+	ps, pm, err := SplitMethod(pattern)
+	if err != nil {
+		return false
+	}
+	s, m, err := SplitMethod(method)
+	if err != nil {
+		return false
+	}
+	return matchName(ps, s) && matchName(pm, m)
+}
+
+func matchName(pattern string, name string) bool {
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := path.Match(lineToHump(pattern), lineToHump(name))
+	return ok
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
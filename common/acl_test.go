@@ -0,0 +1,163 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogf/gf/v2/os/gcfg"
+)
+
+type aclUser struct{}
+
+func (aclUser) GetInfo(args *benchArgs, result *int) error  { return nil }
+func (aclUser) UserInfo(args *benchArgs, result *int) error { return nil }
+func (aclUser) Userinfo(args *benchArgs, result *int) error { return nil }
+func (aclUser) Delete(args *benchArgs, result *int) error   { return nil }
+
+func newACLServer(t *testing.T, acl *ACL) *Server {
+	t.Helper()
+	svr := &Server{}
+	if err := svr.RegisterName("user", aclUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.RegisterName("calc", calcV2{}); err != nil {
+		t.Fatal(err)
+	}
+	for alias, method := range map[string]string{"legacy.info": "user.GetInfo", "legacy.delete": "user.Delete"} {
+		if err := svr.Alias(alias, method); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svr.SetACL(acl)
+	return svr
+}
+
+func TestACL(t *testing.T) {
+	svr := newACLServer(t, &ACL{Rules: []ACLRule{
+		{Methods: []string{"legacy.delete"}, Roles: []string{"root"}},
+		{Methods: []string{"rpc.discover", "user.get_info"}, Roles: []string{"*"}},
+		{Methods: []string{"user.user_info"}, Roles: []string{"admin"}},
+		{Methods: []string{"user.*"}, Roles: []string{"admin"}, Scopes: []string{"user:write"}},
+		{Methods: []string{"*.sub"}, Roles: []string{"ops"}},
+	}})
+	var (
+		anonymous *Principal
+		admin     = &Principal{Id: "a", Roles: []string{"admin"}}
+		writer    = &Principal{Id: "w", Scopes: []string{"user:write"}}
+		ops       = &Principal{Id: "o", Roles: []string{"ops"}}
+		root      = &Principal{Id: "r", Roles: []string{"root"}}
+	)
+	tests := []struct {
+		method string
+		p      *Principal
+		want   bool
+	}{
+		// 角色 * 允许所有调用方，方法名兼容各种命名风格与别名
+		{"user.get_info", anonymous, true},
+		{"user.getInfo", anonymous, true},
+		{"user.GetInfo", anonymous, true},
+		{"legacy.info", anonymous, true},
+		{"rpc.discover", anonymous, true},
+		// 使用第一条匹配的规则，后面更宽松的规则不生效
+		{"user.user_info", admin, true},
+		{"user.userInfo", writer, false},
+		// userinfo 与 user_info 是不同的方法，匹配通配的规则
+		{"user.userinfo", writer, true},
+		{"user.userinfo", anonymous, false},
+		// 别名作为模式时按指向的方法匹配
+		{"user.delete", admin, false},
+		{"user.delete", root, true},
+		{"legacy.delete", root, true},
+		// 通配服务名
+		{"calc.sub", ops, true},
+		{"calc.sub", admin, false},
+		// 没有匹配的规则时按 DefaultAllow 处理
+		{"calc.add", ops, false},
+		{"calc.add", root, false},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.p != nil {
+			ctx = WithPrincipal(ctx, tt.p)
+		}
+		res := svr.HandlerContext(ctx, []byte(`{"jsonrpc":"2.0","id":"1","method":"`+tt.method+`","params":{"a":1,"b":2}}`))
+		if got := responseCode(t, res) != Forbidden; got != tt.want {
+			t.Errorf("%s as %+v: allowed = %v, want %v: %s", tt.method, tt.p, got, tt.want, res)
+		}
+	}
+
+	svr.SetACL(&ACL{DefaultAllow: true, Rules: []ACLRule{{Methods: []string{"calc.*"}, Roles: []string{"ops"}}}})
+	for method, want := range map[string]bool{"user.delete": true, "calc.add": false} {
+		res := svr.HandlerContext(context.Background(), []byte(`{"jsonrpc":"2.0","id":"1","method":"`+method+`","params":{"a":1,"b":2}}`))
+		if got := responseCode(t, res) != Forbidden; got != want {
+			t.Errorf("default allow %s: allowed = %v, want %v", method, got, want)
+		}
+	}
+}
+
+func TestMatchMethod(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		want    bool
+	}{
+		{"*", "user.info", true},
+		{"user.*", "user.Info", true},
+		{"user.*", "order.Info", false},
+		{"*.delete", "order.Delete", true},
+		{"*.delete", "order.DeleteAll", false},
+		{"user.get*", "user.GetInfo", true},
+		{"user.get_info", "user.getInfo", true},
+		{"user.GetInfo", "user.get_info", true},
+		{"user.user_info", "user.UserInfo", true},
+		{"user.user_info", "user.userinfo", false},
+		{"user.userinfo", "user.UserInfo", false},
+		{"/int_rpc/*", "int_rpc.getUser", true},
+		{"int_rpc.get_user", "/int_rpc/getUser", true},
+		{"user", "user.info", false},
+	}
+	for _, tt := range tests {
+		if got := matchMethod(tt.pattern, tt.method); got != tt.want {
+			t.Errorf("matchMethod(%q, %q) = %v, want %v", tt.pattern, tt.method, got, tt.want)
+		}
+	}
+	acl := &ACL{Rules: []ACLRule{{Methods: []string{"user.user_info"}, Roles: []string{"admin"}}}, DefaultAllow: true}
+	if acl.Allow(nil, "user.UserInfo") || !acl.Allow(nil, "user.userinfo") {
+		t.Error("Allow should distinguish user_info from userinfo")
+	}
+}
+
+func TestLoadACL(t *testing.T) {
+	adapter := gcfg.Instance().GetAdapter().(*gcfg.AdapterFile)
+	adapter.SetContent(`
+rpc:
+  acl:
+    defaultAllow: true
+    rules:
+      - methods: ["user.*"]
+        roles: ["admin"]
+        scopes: ["user:write"]
+      - methods: ["rpc.discover"]
+        roles: ["*"]
+`)
+	defer adapter.RemoveContent()
+
+	acl, err := LoadACL(context.Background(), "rpc.acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acl.DefaultAllow || len(acl.Rules) != 2 {
+		t.Fatalf("acl = %+v", acl)
+	}
+	r := acl.Rules[0]
+	if len(r.Methods) != 1 || r.Methods[0] != "user.*" || len(r.Roles) != 1 || r.Roles[0] != "admin" || len(r.Scopes) != 1 || r.Scopes[0] != "user:write" {
+		t.Errorf("rule = %+v", r)
+	}
+	if acl.Allow(nil, "user.delete") || !acl.Allow(&Principal{Roles: []string{"admin"}}, "user.delete") || !acl.Allow(nil, "calc.add") {
+		t.Error("loaded acl does not apply")
+	}
+
+	if _, err = LoadACL(context.Background(), "rpc.missing"); err == nil {
+		t.Error("want error for missing config")
+	}
+}
@@ -0,0 +1,282 @@
+package common
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuthMethod tcp 连接的认证握手方法，认证成功后该连接上的后续请求都使用该身份
+const AuthMethod = "rpc.auth"
+
+// 认证错误
+var (
+	ErrNoCredentials  = errors.New("rpc: 缺少认证信息")
+	ErrBadCredentials = errors.New("rpc: 认证信息无效")
+)
+
+// Principal 认证后的调用方身份，方法中通过 PrincipalFromContext 获取
+type Principal struct {
+	Id     string                 `json:"id"`               // 调用方标识
+	Roles  []string               `json:"roles,omitempty"`  // 调用方的角色
+	Scopes []string               `json:"scopes,omitempty"` // 调用方的授权范围
+	Claims map[string]interface{} `json:"claims,omitempty"` // 其它属性
+}
+
+type principalKey struct{}
+
+// WithPrincipal 将调用方身份放入上下文
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext 获取上下文中的调用方身份，未认证时返回 nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Credentials 请求携带的认证信息，格式与 http 请求头 Authorization 一致
+//
+//	Bearer eyJhbGciOi...
+//	ApiKey 8f3c...
+//	HMAC keyId=app1,timestamp=1700000000,nonce=5f2b9c,signature=5d41...
+type Credentials struct {
+	Scheme  string            // 认证方式，不区分大小写
+	Token   string            // 认证方式之后的内容
+	Params  map[string]string // 以逗号分隔的 key=value 参数
+	Payload []byte            // 签名覆盖的内容，http 请求头为请求体，envelope 的 auth 字段为 method + "\n" + 规范化的 params
+}
+
+// ParseCredentials 解析 Authorization 格式的认证信息
+func ParseCredentials(s string) (*Credentials, error) {
+	s = strings.TrimSpace(s)
+	scheme, token := s, ""
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		scheme, token = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	if scheme == "" || token == "" {
+		return nil, ErrBadCredentials
+	}
+	c := &Credentials{Scheme: scheme, Token: token, Params: make(map[string]string)}
+	for _, item := range strings.Split(token, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(item), "="); ok {
+			c.Params[k] = strings.Trim(v, `"`)
+		}
+	}
+	return c, nil
+}
+
+// Authenticator 认证器，按 Scheme 处理对应方式的认证信息，认证失败时返回错误
+type Authenticator interface {
+	Scheme() string
+	Authenticate(ctx context.Context, c *Credentials) (*Principal, error)
+}
+
+// AuthOptions 认证配置
+type AuthOptions struct {
+	Authenticators []Authenticator // 支持的认证方式，为空时不认证
+	Optional       bool            // 未携带认证信息的请求以匿名身份执行，携带了错误的认证信息仍然拒绝
+	Public         []string        // 无需认证的服务或方法，支持别名与各种命名风格，也可以是 rpc.discover
+}
+
+// SetAuth 设置认证方式，未通过认证的请求返回 Unauthorized 错误
+func (svr *Server) SetAuth(o AuthOptions) {
+	svr.auth.Store(&o)
+}
+
+// Authenticate 使用对应方式的认证器认证
+func (svr *Server) Authenticate(ctx context.Context, c *Credentials) (*Principal, error) {
+	o, _ := svr.auth.Load().(*AuthOptions)
+	if o == nil {
+		return nil, ErrBadCredentials
+	}
+	for _, a := range o.Authenticators {
+		if strings.EqualFold(a.Scheme(), c.Scheme) {
+			p, err := a.Authenticate(ctx, c)
+			if err == nil && p == nil {
+				err = ErrBadCredentials
+			}
+			return p, err
+		}
+	}
+	return nil, fmt.Errorf("rpc: 不支持的认证方式 %s", c.Scheme)
+}
+
+// AuthenticatePeer 认证连接级别的认证信息，如 http 请求头，结果保存到 Peer 中供该连接的请求使用
+func (svr *Server) AuthenticatePeer(ctx context.Context, peer *Peer, authorization string, payload []byte) {
+	c, err := ParseCredentials(authorization)
+	if err == nil {
+		c.Payload = payload
+		peer.Principal, err = svr.Authenticate(ctx, c)
+	}
+	peer.authErr = err
+}
+
+// authenticate 认证单个请求，envelope 的 auth 字段优先于连接级别的认证信息
+func (svr *Server) authenticate(ctx context.Context, req *RawRequest, svc *Service, m *Method) (*Principal, error) {
+	o, _ := svr.auth.Load().(*AuthOptions)
+	// 认证握手由 authHandshake 处理
+	if o == nil || len(o.Authenticators) == 0 || req.Method == AuthMethod {
+		return nil, nil
+	}
+	// 请求级别的认证信息优先于连接级别：auth 字段、sign 字段、http 请求头或 tcp 握手
+	if req.Auth != "" {
+		c, err := ParseCredentials(req.Auth)
+		if err != nil {
+			return nil, err
+		}
+		params, err := req.jsonParams()
+		if err != nil {
+			return nil, ErrBadCredentials
+		}
+		canonical, err := CanonicalParams(params)
+		if err != nil {
+			return nil, ErrBadCredentials
+		}
+		c.Payload = authPayload(req.Method, canonical)
+		return svr.Authenticate(ctx, c)
+	}
+	// 已签名的请求使用签名的密钥标识
+	if p := PrincipalFromContext(ctx); p != nil {
+		return p, nil
+	}
+	peer := PeerFromContext(ctx)
+	if peer != nil && peer.Principal != nil {
+		return peer.Principal, nil
+	}
+	if peer != nil && peer.authErr != nil {
+		return nil, peer.authErr
+	}
+	if o.Optional || svr.isPublic(o.Public, req.Method, svc, m) {
+		return nil, nil
+	}
+	return nil, ErrNoCredentials
+}
+
+func (svr *Server) isPublic(list []string, method string, svc *Service, m *Method) bool {
+	// matchMethods 的空列表匹配所有方法，未设置 Public 时所有方法都需要认证
+	if len(list) == 0 {
+		return false
+	}
+	for _, v := range list {
+		if v == method {
+			return true
+		}
+	}
+	if svc == nil || m == nil {
+		return false
+	}
+	return svr.matchMethods(list, svc.Name, m.Name)
+}
+
+// authPayload 单个请求签名覆盖的内容 method + "\n" + 规范化的 params，auth 字段的 HMAC 认证与 sign 字段共用
+func authPayload(method string, params []byte) []byte {
+	return append([]byte(method+"\n"), params...)
+}
+
+// authHandshake 处理 tcp 连接的认证握手，参数为 ["Bearer xxx"] 或 {"authorization": "Bearer xxx"}
+func (svr *Server) authHandshake(ctx context.Context, req *RawRequest) (*Principal, error) {
+	peer := PeerFromContext(ctx)
+	if peer == nil {
+		return nil, errors.New("rpc: 当前协议不支持认证握手")
+	}
+	if o, _ := svr.auth.Load().(*AuthOptions); o == nil || len(o.Authenticators) == 0 {
+		return nil, errors.New("rpc: 服务端未开启认证")
+	}
+	var p struct {
+		Authorization string `json:"authorization"`
+	}
+	if err := req.decodeParams(&p, false); err != nil || p.Authorization == "" {
+		return nil, ErrNoCredentials
+	}
+	svr.AuthenticatePeer(ctx, peer, p.Authorization, nil)
+	return peer.Principal, peer.authErr
+}
+
+// BearerAuth Bearer 令牌认证，verify 校验令牌并返回调用方身份
+func BearerAuth(verify func(ctx context.Context, token string) (*Principal, error)) Authenticator {
+	return &funcAuthenticator{scheme: "Bearer", fn: func(ctx context.Context, c *Credentials) (*Principal, error) {
+		return verify(ctx, c.Token)
+	}}
+}
+
+// APIKeyAuth api key 认证，keys 为 api key 到调用方身份的映射
+// http 协议同时支持 X-Api-Key 请求头
+func APIKeyAuth(keys map[string]*Principal) Authenticator {
+	return &funcAuthenticator{scheme: "ApiKey", fn: func(ctx context.Context, c *Credentials) (*Principal, error) {
+		var found *Principal
+		// 逐个比较所有 key，避免通过响应时间猜测
+		for k, p := range keys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(c.Token)) == 1 {
+				found = p
+			}
+		}
+		if found == nil {
+			return nil, ErrBadCredentials
+		}
+		return found, nil
+	}}
+}
+
+// HMACAuth 签名认证，secret 按 keyId 返回密钥与调用方身份
+// 与请求签名使用相同的算法，签名为 hex(HMAC-SHA256(secret, timestamp + "\n" + nonce + "\n" + payload))，
+// 时间戳与服务端相差超过 maxSkew 时拒绝，maxSkew 为 0 时为 5 分钟，nonce 在有效期内不能重复使用，nonces 为 nil 时使用内存存储
+func HMACAuth(secret func(ctx context.Context, keyId string) (string, *Principal, error), maxSkew time.Duration, nonces NonceStore) Authenticator {
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	if nonces == nil {
+		nonces = NewMemoryNonceStore()
+	}
+	return &funcAuthenticator{scheme: "HMAC", fn: func(ctx context.Context, c *Credentials) (*Principal, error) {
+		keyId, ts, nonce, sig := c.Params["keyId"], c.Params["timestamp"], c.Params["nonce"], c.Params["signature"]
+		if keyId == "" || ts == "" || nonce == "" || sig == "" {
+			return nil, ErrBadCredentials
+		}
+		key, p, err := secret(ctx, keyId)
+		if err != nil {
+			return nil, err
+		}
+		if err = verifyHMAC(key, keyId, ts, nonce, sig, c.Payload, maxSkew, nonces); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}}
+}
+
+// HMACSignature 计算签名 hex(HMAC-SHA256(secret, timestamp + "\n" + nonce + "\n" + payload))
+func HMACSignature(secret string, timestamp string, nonce string, payload []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "\n" + nonce + "\n"))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HMACCredentials 生成 HMAC 方式的认证信息，客户端使用，每次调用生成新的 nonce
+func HMACCredentials(keyId string, secret string, payload []byte) string {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	n := hex.EncodeToString(nonce)
+	return fmt.Sprintf("HMAC keyId=%s,timestamp=%s,nonce=%s,signature=%s", keyId, ts, n, HMACSignature(secret, ts, n, payload))
+}
+
+type funcAuthenticator struct {
+	scheme string
+	fn     func(ctx context.Context, c *Credentials) (*Principal, error)
+}
+
+func (a *funcAuthenticator) Scheme() string { return a.scheme }
+
+func (a *funcAuthenticator) Authenticate(ctx context.Context, c *Credentials) (*Principal, error) {
+	return a.fn(ctx, c)
+}
@@ -0,0 +1,217 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type whoService struct{}
+
+// Who 返回调用方标识，未认证时返回 anonymous
+func (whoService) Who(ctx context.Context, args *benchArgs, result *string) error {
+	*result = "anonymous"
+	if p := PrincipalFromContext(ctx); p != nil {
+		*result = p.Id
+	}
+	return nil
+}
+
+func newAuthServer(t *testing.T, optional bool, public ...string) *Server {
+	t.Helper()
+	svr := &Server{}
+	if err := svr.RegisterName("who", whoService{}); err != nil {
+		t.Fatal(err)
+	}
+	svr.SetAuth(AuthOptions{
+		Authenticators: []Authenticator{
+			BearerAuth(func(ctx context.Context, token string) (*Principal, error) {
+				if token != "t1" {
+					return nil, ErrBadCredentials
+				}
+				return &Principal{Id: "alice"}, nil
+			}),
+			APIKeyAuth(map[string]*Principal{"k1": {Id: "bob"}}),
+			HMACAuth(func(ctx context.Context, keyId string) (string, *Principal, error) {
+				if keyId != "app1" {
+					return "", nil, ErrBadCredentials
+				}
+				return "s3cret", &Principal{Id: "app1"}, nil
+			}, time.Minute, nil),
+		},
+		Optional: optional,
+		Public:   public,
+	})
+	return svr
+}
+
+// authRequest 生成携带 auth 字段的请求，auth 为空时不携带
+func authRequest(method string, auth string) []byte {
+	req := map[string]interface{}{"jsonrpc": "2.0", "id": "1", "method": method, "params": map[string]int{"a": 1, "b": 2}}
+	if auth != "" {
+		req["auth"] = auth
+	}
+	b, _ := json.Marshal(req)
+	return b
+}
+
+// who 返回调用方标识与错误码
+func who(t *testing.T, svr *Server, ctx context.Context, auth string) (string, int) {
+	t.Helper()
+	res := svr.HandlerContext(ctx, authRequest("who.who", auth))
+	var r struct {
+		Result string `json:"result"`
+	}
+	_ = json.Unmarshal(res, &r)
+	return r.Result, responseCode(t, res)
+}
+
+func TestAuthenticators(t *testing.T) {
+	payload := authPayload("who.who", []byte(`{"a":1,"b":2}`))
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	hmacAuth := func(keyId string, secret string, ts string, nonce string, payload []byte) string {
+		return fmt.Sprintf("HMAC keyId=%s,timestamp=%s,nonce=%s,signature=%s", keyId, ts, nonce, HMACSignature(secret, ts, nonce, payload))
+	}
+	tests := []struct {
+		name string
+		auth string
+		want string
+		code int
+	}{
+		{"missing", "", "", Unauthorized},
+		{"bearer", "Bearer t1", "alice", WithoutError},
+		{"bearer case insensitive", "bearer t1", "alice", WithoutError},
+		{"bearer wrong token", "Bearer t2", "", Unauthorized},
+		{"api key", "ApiKey k1", "bob", WithoutError},
+		{"api key wrong key", "ApiKey k2", "", Unauthorized},
+		{"unsupported scheme", "Basic dXNlcg==", "", Unauthorized},
+		{"malformed", "Bearer", "", Unauthorized},
+		{"hmac", hmacAuth("app1", "s3cret", ts, "n1", payload), "app1", WithoutError},
+		{"hmac replayed nonce", hmacAuth("app1", "s3cret", ts, "n1", payload), "", Unauthorized},
+		{"hmac wrong secret", hmacAuth("app1", "other", ts, "n2", payload), "", Unauthorized},
+		{"hmac unknown key", hmacAuth("app2", "s3cret", ts, "n3", payload), "", Unauthorized},
+		{"hmac other params", hmacAuth("app1", "s3cret", ts, "n4", authPayload("who.who", []byte(`{"a":1,"b":3}`))), "", Unauthorized},
+		{"hmac stale timestamp", hmacAuth("app1", "s3cret", stale, "n5", payload), "", Unauthorized},
+		{"hmac missing params", "HMAC keyId=app1,timestamp=" + ts, "", Unauthorized},
+	}
+	svr := newAuthServer(t, false, DiscoverMethod)
+	for _, tt := range tests {
+		got, code := who(t, svr, context.Background(), tt.auth)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%s: who = %q, code %d, want %q, code %d", tt.name, got, code, tt.want, tt.code)
+		}
+	}
+
+	// 公开的方法无需认证
+	if code := responseCode(t, svr.HandlerContext(context.Background(), authRequest(DiscoverMethod, ""))); code != WithoutError {
+		t.Errorf("public method code = %d", code)
+	}
+	// 未设置 Public 时所有方法都需要认证
+	svr = newAuthServer(t, false)
+	if code := responseCode(t, svr.HandlerContext(context.Background(), authRequest(DiscoverMethod, ""))); code != Unauthorized {
+		t.Errorf("without public methods code = %d, want %d", code, Unauthorized)
+	}
+}
+
+// Optional 时未携带认证信息以匿名身份执行，携带了错误的认证信息仍然拒绝
+func TestAuthOptional(t *testing.T) {
+	svr := newAuthServer(t, true)
+	if got, code := who(t, svr, context.Background(), ""); got != "anonymous" || code != WithoutError {
+		t.Errorf("anonymous = %q, code %d", got, code)
+	}
+	if _, code := who(t, svr, context.Background(), "ApiKey k2"); code != Unauthorized {
+		t.Errorf("wrong key code = %d, want %d", code, Unauthorized)
+	}
+}
+
+// 连接级别的认证，http 请求头与 tcp 认证握手的结果保存在 Peer 中
+func TestAuthenticatePeer(t *testing.T) {
+	svr := newAuthServer(t, false)
+	peer := &Peer{Transport: "http"}
+	svr.AuthenticatePeer(context.Background(), peer, "Bearer t1", nil)
+	ctx := WithPeer(context.Background(), peer)
+	if got, code := who(t, svr, ctx, ""); got != "alice" || code != WithoutError {
+		t.Errorf("peer principal = %q, code %d", got, code)
+	}
+	// 请求的 auth 字段优先于连接级别的认证信息
+	if got, _ := who(t, svr, ctx, "ApiKey k1"); got != "bob" {
+		t.Errorf("auth field principal = %q, want bob", got)
+	}
+
+	peer = &Peer{Transport: "http"}
+	svr.AuthenticatePeer(context.Background(), peer, "Bearer t2", nil)
+	if _, code := who(t, svr, WithPeer(context.Background(), peer), ""); code != Unauthorized {
+		t.Errorf("wrong token code = %d", code)
+	}
+}
+
+func TestAuthHandshake(t *testing.T) {
+	svr := newAuthServer(t, false)
+	peer := &Peer{Transport: "tcp"}
+	ctx := WithPeer(context.Background(), peer)
+	handshake := func(params string) ([]byte, int) {
+		res := svr.HandlerContext(ctx, []byte(`{"jsonrpc":"2.0","id":"auth","method":"rpc.auth","params":`+params+`}`))
+		return res, responseCode(t, res)
+	}
+
+	// 握手前的请求未认证，所有请求都被拒绝时 Rejected 返回 Unauthorized
+	if _, code := who(t, svr, ctx, ""); code != Unauthorized {
+		t.Errorf("before handshake code = %d", code)
+	}
+	if code, _ := peer.Rejected(); code != Unauthorized {
+		t.Errorf("rejected code = %d, want %d", code, Unauthorized)
+	}
+	// Reset 只清空请求计数
+	peer.Reset()
+	if code, _ := peer.Rejected(); code != 0 {
+		t.Errorf("rejected code after reset = %d", code)
+	}
+
+	if _, code := handshake(`{}`); code != Unauthorized {
+		t.Errorf("empty handshake code = %d", code)
+	}
+	if _, code := handshake(`["ApiKey k2"]`); code != Unauthorized {
+		t.Errorf("wrong key handshake code = %d", code)
+	}
+	// 握手失败后连接上的请求返回失败的原因
+	peer.Reset()
+	if _, code := who(t, svr, ctx, ""); code != Unauthorized {
+		t.Errorf("after failed handshake code = %d", code)
+	}
+
+	res, code := handshake(`["ApiKey k1"]`)
+	var r struct {
+		Result Principal `json:"result"`
+	}
+	if err := json.Unmarshal(res, &r); err != nil || code != WithoutError || r.Result.Id != "bob" {
+		t.Fatalf("handshake = %s", res)
+	}
+	// 认证后的身份在连接上的后续请求中保持，不受 Reset 影响
+	for i := 0; i < 3; i++ {
+		peer.Reset()
+		if got, code := who(t, svr, ctx, ""); got != "bob" || code != WithoutError {
+			t.Errorf("request %d: who = %q, code %d", i, got, code)
+		}
+		if code, _ := peer.Rejected(); code != 0 {
+			t.Errorf("request %d: rejected code = %d", i, code)
+		}
+	}
+
+	// 重新握手替换连接的身份
+	if _, code := handshake(`{"authorization":"Bearer t1"}`); code != WithoutError {
+		t.Errorf("second handshake code = %d", code)
+	}
+	if got, _ := who(t, svr, ctx, ""); got != "alice" {
+		t.Errorf("after second handshake who = %q, want alice", got)
+	}
+
+	// 没有连接信息的协议不支持握手
+	res = svr.HandlerContext(context.Background(), []byte(`{"jsonrpc":"2.0","id":"auth","method":"rpc.auth","params":["ApiKey k1"]}`))
+	if code := responseCode(t, res); code != Unauthorized {
+		t.Errorf("handshake without peer = %s", res)
+	}
+}
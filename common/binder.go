@@ -0,0 +1,439 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 参数错误的原因
+const (
+	ParamUnknown = "unknown" // 结构体中不存在该字段
+	ParamMissing = "missing" // 缺少必填字段
+	ParamType    = "type"    // 字段类型不匹配
+)
+
+// ParamError 单个参数的绑定错误，作为 InvalidParams 错误的 data 返回
+type ParamError struct {
+	Field   string `json:"field"`
+	Reason  string `json:"reason"`
+	Expect  string `json:"expect,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// BindError 参数绑定失败，包含所有字段的错误
+type BindError struct {
+	Errors []ParamError
+}
+
+func (e *BindError) Error() string {
+	msg := make([]string, 0, len(e.Errors))
+	for _, v := range e.Errors {
+		msg = append(msg, v.Message)
+	}
+	return "rpc: 参数绑定失败 " + strings.Join(msg, "；")
+}
+
+// BindParams 将请求参数绑定到 pv 指向的值
+// 参数为对象时按 json 标签匹配字段，为数组时按字段声明顺序匹配
+// 严格模式下不允许未知字段、缺少必填字段以及任何类型转换，宽松模式下忽略未知与缺少的字段，并尝试转换字符串与数字等类型
+func BindParams(data interface{}, pv interface{}, strict bool) error {
+	rv := reflect.ValueOf(pv)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("无效的类型元素 %s，需要类型为指针", reflect.TypeOf(pv))
+	}
+	b := &binder{strict: strict}
+	rv = rv.Elem()
+	isStruct := rv.Kind() == reflect.Struct && !isJSONType(rv)
+	if list, ok := data.([]interface{}); ok && isStruct {
+		b.bindPositional(list, rv)
+	} else if data == nil && isStruct {
+		// 未提供参数时视为空对象
+		b.bindStruct("", map[string]interface{}{}, rv)
+	} else if list, ok := data.([]interface{}); ok && len(list) == 1 && isScalar(rv) {
+		// 基础类型的参数按位置传递时只有一个元素 [1]
+		b.bind("", list[0], rv)
+	} else if data != nil {
+		b.bind("", data, rv)
+	}
+	if len(b.errors) > 0 {
+		return &BindError{Errors: b.errors}
+	}
+	return nil
+}
+
+type binder struct {
+	strict bool
+	errors []ParamError
+}
+
+func (b *binder) fail(path string, reason string, expect reflect.Type) {
+	e := ParamError{Field: path, Reason: reason}
+	if path == "" {
+		e.Field = "params"
+	}
+	switch reason {
+	case ParamUnknown:
+		e.Message = fmt.Sprintf("未知字段 %s", e.Field)
+	case ParamMissing:
+		e.Message = fmt.Sprintf("缺少必填字段 %s", e.Field)
+	default:
+		e.Expect = typeName(expect)
+		e.Message = fmt.Sprintf("字段 %s 需要为 %s 类型", e.Field, e.Expect)
+	}
+	b.errors = append(b.errors, e)
+}
+
+// bindPositional 按字段声明顺序绑定数组参数
+func (b *binder) bindPositional(list []interface{}, rv reflect.Value) {
+	fields := structFields(rv.Type())
+	for i, f := range fields {
+		if i >= len(list) {
+			if b.strict && f.required {
+				b.fail(f.name, ParamMissing, f.typ)
+			}
+			continue
+		}
+		b.bind(f.name, list[i], rv.FieldByIndex(f.index))
+	}
+	for i := len(fields); i < len(list); i++ {
+		b.fail(fmt.Sprintf("[%d]", i), ParamUnknown, nil)
+	}
+}
+
+func (b *binder) bind(path string, v interface{}, rv reflect.Value) {
+	// 实现了 json.Unmarshaler 的类型交给 encoding/json 处理
+	if isJSONType(rv) {
+		b.bindJSON(path, v, rv)
+		return
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if v == nil {
+			return
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		b.bind(path, v, rv.Elem())
+	case reflect.Interface:
+		if v == nil {
+			return
+		}
+		// interface{} 与 encoding/json 一致，数字使用 float64
+		v = plainNumbers(v)
+		if !reflect.TypeOf(v).AssignableTo(rv.Type()) {
+			b.fail(path, ParamType, rv.Type())
+			return
+		}
+		rv.Set(reflect.ValueOf(v))
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			if v == nil && !b.strict {
+				return
+			}
+			b.fail(path, ParamType, rv.Type())
+			return
+		}
+		b.bindStruct(path, m, rv)
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			if v == nil {
+				return
+			}
+			b.bindJSON(path, v, rv)
+			return
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMapWithSize(rv.Type(), len(m)))
+		}
+		for k, mv := range m {
+			ev := reflect.New(rv.Type().Elem()).Elem()
+			b.bind(join(path, k), mv, ev)
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), ev)
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := v.([]interface{})
+		if !ok {
+			if v == nil {
+				return
+			}
+			// []byte 以 base64 字符串传输
+			b.bindJSON(path, v, rv)
+			return
+		}
+		if rv.Kind() == reflect.Slice {
+			rv.Set(reflect.MakeSlice(rv.Type(), len(list), len(list)))
+		} else if len(list) > rv.Len() {
+			b.fail(path, ParamType, rv.Type())
+			return
+		}
+		for i, ev := range list {
+			b.bind(fmt.Sprintf("%s[%d]", path, i), ev, rv.Index(i))
+		}
+	default:
+		if !b.bindScalar(v, rv) {
+			b.fail(path, ParamType, rv.Type())
+		}
+	}
+}
+
+func (b *binder) bindStruct(path string, m map[string]interface{}, rv reflect.Value) {
+	used := make(map[string]bool, len(m))
+	for _, f := range structFields(rv.Type()) {
+		key, ok := b.match(m, used, f, rv.Type())
+		if !ok {
+			if b.strict && f.required {
+				b.fail(join(path, f.name), ParamMissing, f.typ)
+			}
+			continue
+		}
+		used[key] = true
+		b.bind(join(path, f.name), m[key], rv.FieldByIndex(f.index))
+	}
+	if b.strict {
+		unknown := make([]string, 0)
+		for k := range m {
+			if !used[k] {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+		for _, k := range unknown {
+			b.fail(join(path, k), ParamUnknown, nil)
+		}
+	}
+}
+
+// match 查找字段对应的键，严格模式只匹配 json 名称，宽松模式兼容大小写不同以及 Go 字段名
+func (b *binder) match(m map[string]interface{}, used map[string]bool, f field, t reflect.Type) (string, bool) {
+	if _, ok := m[f.name]; ok {
+		return f.name, true
+	}
+	if b.strict {
+		return "", false
+	}
+	goName := t.FieldByIndex(f.index).Name
+	for k := range m {
+		if !used[k] && (strings.EqualFold(k, f.name) || strings.EqualFold(k, goName)) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// bindJSON 通过 encoding/json 绑定，不做类型转换
+func (b *binder) bindJSON(path string, v interface{}, rv reflect.Value) {
+	raw, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(raw, rv.Addr().Interface())
+	}
+	if err != nil {
+		b.fail(path, ParamType, rv.Type())
+	}
+}
+
+// bindScalar 绑定基础类型，宽松模式下允许字符串、数字与布尔值之间的转换
+func (b *binder) bindScalar(v interface{}, rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Bool:
+		switch x := v.(type) {
+		case bool:
+			rv.SetBool(x)
+			return true
+		case string:
+			if p, err := strconv.ParseBool(x); err == nil && !b.strict {
+				rv.SetBool(p)
+				return true
+			}
+		case float64, json.Number:
+			if f, _ := b.number(x); !b.strict && (f == 0 || f == 1) {
+				rv.SetBool(f == 1)
+				return true
+			}
+		}
+	case reflect.String:
+		switch x := v.(type) {
+		case string:
+			rv.SetString(x)
+			return true
+		case float64, json.Number, bool:
+			if !b.strict {
+				rv.SetString(fmt.Sprint(x))
+				return true
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := b.integer(v)
+		if !ok || rv.OverflowInt(i) {
+			return false
+		}
+		rv.SetInt(i)
+		return true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, ok := b.unsigned(v)
+		if !ok || rv.OverflowUint(u) {
+			return false
+		}
+		rv.SetUint(u)
+		return true
+	case reflect.Float32, reflect.Float64:
+		f, ok := b.number(v)
+		if !ok || rv.OverflowFloat(f) {
+			return false
+		}
+		rv.SetFloat(f)
+		return true
+	}
+	return false
+}
+
+// integer 解析有符号整数，json.Number 与字符串直接按整数解析，避免超过 2^53 的整数经过 float64 丢失精度
+func (b *binder) integer(v interface{}) (int64, bool) {
+	s, ok := b.literal(v)
+	if !ok {
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	// 1e3、5.0 等整数值的其它写法
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// unsigned 解析无符号整数，规则与 integer 相同
+func (b *binder) unsigned(v interface{}) (uint64, bool) {
+	s, ok := b.literal(v)
+	if !ok {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f != math.Trunc(f) || f >= math.MaxUint64 {
+			return 0, false
+		}
+		return uint64(f), true
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f != math.Trunc(f) || f >= math.MaxUint64 {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
+// literal 返回数字的原始文本，宽松模式下包括字符串
+func (b *binder) literal(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case json.Number:
+		return x.String(), true
+	case string:
+		if !b.strict {
+			return strings.TrimSpace(x), true
+		}
+	}
+	return "", false
+}
+
+func (b *binder) number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		if !b.strict {
+			f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+			return f, err == nil
+		}
+	}
+	return 0, false
+}
+
+// plainNumbers 将 UseNumber 解析出的 json.Number 转换为 float64
+func plainNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = plainNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = plainNumbers(item)
+		}
+	}
+	return v
+}
+
+// isScalar 检测是否为字符串、数字、布尔等基础类型
+func isScalar(rv reflect.Value) bool {
+	if isJSONType(rv) {
+		return false
+	}
+	switch indirectType(rv.Type()).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func isJSONType(rv reflect.Value) bool {
+	return rv.Kind() != reflect.Interface && rv.CanAddr() && rv.Addr().Type().Implements(unmarshalerType)
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// typeName 返回字段在 json 中对应的类型名称
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "array"
+	case reflect.Map, reflect.Struct:
+		if t == timeType {
+			return "string"
+		}
+		return "object"
+	}
+	return t.String()
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeRawIntegerPrecision(t *testing.T) {
+	type params struct {
+		Id   int64       `json:"id"`
+		Uid  uint64      `json:"uid"`
+		Name string      `json:"name"`
+		Any  interface{} `json:"any"`
+	}
+	cases := []struct {
+		raw    string
+		strict bool
+	}{
+		{`{"id":9007199254740993,"uid":18446744073709551615,"name":"x","any":1}`, true},
+		{`{"id":9007199254740993,"uid":18446744073709551615,"name":"x","any":1}`, false},
+		{`[9007199254740993,18446744073709551615,"x",1]`, true},
+		{`[9007199254740993,18446744073709551615,"x",1]`, false},
+		{`{"id":"9007199254740993","uid":"18446744073709551615","name":"x","any":1}`, false},
+	}
+	for _, c := range cases {
+		var p params
+		if err := DecodeRaw(json.RawMessage(c.raw), &p, c.strict); err != nil {
+			t.Fatalf("%s strict=%v: %v", c.raw, c.strict, err)
+		}
+		if p.Id != 9007199254740993 || p.Uid != 18446744073709551615 {
+			t.Errorf("%s strict=%v: got id=%d uid=%d", c.raw, c.strict, p.Id, p.Uid)
+		}
+		// interface{} 与 encoding/json 一致使用 float64
+		if _, ok := p.Any.(float64); !ok {
+			t.Errorf("%s strict=%v: any is %T, want float64", c.raw, c.strict, p.Any)
+		}
+	}
+}
+
+func TestDecodeRawIntegerForms(t *testing.T) {
+	var p struct {
+		A int  `json:"a"`
+		B uint `json:"b"`
+	}
+	if err := DecodeRaw(json.RawMessage(`{"a":1e3,"b":5.0}`), &p, false); err != nil {
+		t.Fatal(err)
+	}
+	if p.A != 1000 || p.B != 5 {
+		t.Errorf("got %+v", p)
+	}
+	if err := DecodeRaw(json.RawMessage(`{"a":1.5}`), &p, false); err == nil {
+		t.Error("fractional value bound to int")
+	}
+	if err := DecodeRaw(json.RawMessage(`{"b":-1}`), &p, false); err == nil {
+		t.Error("negative value bound to uint")
+	}
+}
@@ -0,0 +1,349 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// Codec 消息编码，实现了 RawCodec 的编码直接解析与序列化，其它编码在收发时与 json 相互转换
+type Codec interface {
+	Name() string                          // 编码名称
+	ContentType() string                   // http 请求头 Content-Type
+	Marshal(v interface{}) ([]byte, error) // 编码
+	Unmarshal(b []byte, v interface{}) error
+}
+
+// RawCodec 可以保留原始数据的编码，协议字段先解析，params 与 result 确定目标类型后再直接解析，不经过 json 转换
+// 内置的 json、msgpack、cbor 编码都实现了该接口
+type RawCodec interface {
+	Codec
+	UnmarshalArray(b []byte) ([][]byte, error)           // 解析数组，返回每个元素的原始数据，不是数组时返回错误
+	UnmarshalObject(b []byte) (map[string][]byte, error) // 解析对象，返回每个字段的原始数据，不是对象时返回错误
+}
+
+var (
+	JSON    Codec = jsonCodec{}    // 默认编码
+	MsgPack Codec = msgpackCodec{} // MessagePack 编码
+	CBOR    Codec = newCborCodec() // CBOR 编码
+)
+
+var codecs = sync.Map{}
+
+func init() {
+	RegisterCodec(JSON)
+	RegisterCodec(MsgPack)
+	RegisterCodec(CBOR)
+}
+
+// RegisterCodec 注册编码，可按名称或 Content-Type 查找
+func RegisterCodec(c Codec) {
+	codecs.Store(c.Name(), c)
+	codecs.Store(c.ContentType(), c)
+}
+
+// GetCodec 按名称或 Content-Type 查找编码，为空时返回 json
+func GetCodec(name string) (Codec, bool) {
+	if name == "" {
+		return JSON, true
+	}
+	if mt, _, err := mime.ParseMediaType(name); err == nil {
+		name = mt
+	}
+	c, ok := codecs.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return c.(Codec), true
+}
+
+// IsJSON 检测是否为 json 编码，nil 视为 json
+func IsJSON(c Codec) bool {
+	return c == nil || c.Name() == JSON.Name()
+}
+
+// AsRawCodec 返回可以直接解析的编码，nil 视为 json，未实现 RawCodec 的编码需要先转换为 json
+func AsRawCodec(c Codec) (RawCodec, bool) {
+	if c == nil {
+		return JSON.(RawCodec), true
+	}
+	rc, ok := c.(RawCodec)
+	return rc, ok
+}
+
+// Encode 按编码序列化 v，未实现 RawCodec 的编码先序列化为 json 再转换
+func Encode(c Codec, v interface{}) ([]byte, error) {
+	if IsJSON(c) {
+		return json.Marshal(v)
+	}
+	if _, ok := c.(RawCodec); ok {
+		return c.Marshal(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(c, b)
+}
+
+// decodeValue 将编码的原始数据解析到 pv 中，目标为 json.RawMessage 时转换为 json
+// 宽松模式下先由编码直接解析，失败时与 DecodeRaw 一样通过 BindParams 转换类型并给出每个字段的错误
+func decodeValue(c RawCodec, raw []byte, pv interface{}, strict bool) error {
+	if IsJSON(c) {
+		return DecodeRaw(raw, pv, strict)
+	}
+	if rm, ok := pv.(*json.RawMessage); ok {
+		b, err := ToJSON(c, raw)
+		*rm = b
+		return err
+	}
+	rv := reflect.ValueOf(pv).Elem()
+	if !strict && len(raw) > 0 && !(rv.Kind() == reflect.Struct && isArray(c, raw)) {
+		if err := c.Unmarshal(raw, pv); err == nil {
+			return nil
+		}
+		rv.Set(reflect.Zero(rv.Type()))
+	}
+	var data interface{}
+	if len(raw) > 0 {
+		if err := c.Unmarshal(raw, &data); err != nil {
+			return err
+		}
+	}
+	return BindParams(fromCodec(data), pv, strict)
+}
+
+// isArray 检测原始数据是否为数组，按位置传递的结构体参数只能由 BindParams 处理
+func isArray(c RawCodec, raw []byte) bool {
+	_, err := c.UnmarshalArray(raw)
+	return err == nil
+}
+
+// ToJSON 将编码后的数据转换为 json
+func ToJSON(c Codec, b []byte) ([]byte, error) {
+	if IsJSON(c) {
+		return b, nil
+	}
+	var v interface{}
+	if err := c.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fromCodec(v))
+}
+
+// FromJSON 将 json 转换为指定编码，数字保持整数与浮点数的区别
+func FromJSON(c Codec, b []byte) ([]byte, error) {
+	if IsJSON(c) {
+		return b, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return c.Marshal(toCodec(v))
+}
+
+// fromCodec 将 cbor 解析出的 map[interface{}]interface{} 转换为 json 支持的结构
+// 整数转换为 json.Number，与 json 解析的结果一致，超过 2^53 的整数不丢失精度
+func fromCodec(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64, int, uint:
+		return json.Number(fmt.Sprint(x))
+	case float32:
+		return json.Number(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[fmt.Sprint(k)] = fromCodec(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = fromCodec(e)
+		}
+	case []interface{}:
+		for k, e := range x {
+			x[k] = fromCodec(e)
+		}
+	}
+	return v
+}
+
+// toCodec 将 json.Number 转换为整数或浮点数，避免被编码为字符串
+func toCodec(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		if f, err := x.Float64(); err == nil && !math.IsInf(f, 0) {
+			return f
+		}
+		return x.String()
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = toCodec(e)
+		}
+	case []interface{}:
+		for k, e := range x {
+			x[k] = toCodec(e)
+		}
+	}
+	return v
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+func (jsonCodec) UnmarshalArray(b []byte) ([][]byte, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(b, &list); err != nil || list == nil {
+		return nil, errNotArray
+	}
+	return rawList(list), nil
+}
+
+func (jsonCodec) UnmarshalObject(b []byte) (map[string][]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil || m == nil {
+		return nil, errNotObject
+	}
+	return rawMap(m), nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(b []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// msgpackNil msgpack 的空值，RawMessage 解析空值时得到空切片，需要还原
+var msgpackNil = []byte{msgpcode.Nil}
+
+func (c msgpackCodec) UnmarshalArray(b []byte) ([][]byte, error) {
+	var list []msgpack.RawMessage
+	if err := c.Unmarshal(b, &list); err != nil || list == nil {
+		return nil, errNotArray
+	}
+	res := rawList(list)
+	for i, v := range res {
+		if len(v) == 0 {
+			res[i] = msgpackNil
+		}
+	}
+	return res, nil
+}
+
+func (c msgpackCodec) UnmarshalObject(b []byte) (map[string][]byte, error) {
+	var m map[string]msgpack.RawMessage
+	if err := c.Unmarshal(b, &m); err != nil || m == nil {
+		return nil, errNotObject
+	}
+	res := rawMap(m)
+	for k, v := range res {
+		if len(v) == 0 {
+			res[k] = msgpackNil
+		}
+	}
+	return res, nil
+}
+
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+var mapType = reflect.TypeOf(map[string]interface{}{})
+
+func newCborCodec() Codec {
+	// 时间与 json 一样编码为 RFC 3339 字符串，保留纳秒精度
+	enc, _ := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	dec, _ := cbor.DecOptions{DefaultMapType: mapType}.DecMode()
+	return cborCodec{enc: enc, dec: dec}
+}
+
+func (cborCodec) Name() string        { return "cbor" }
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (c cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.enc.Marshal(v)
+}
+
+func (c cborCodec) Unmarshal(b []byte, v interface{}) error {
+	return c.dec.Unmarshal(b, v)
+}
+
+func (c cborCodec) UnmarshalArray(b []byte) ([][]byte, error) {
+	var list []cbor.RawMessage
+	if err := c.dec.Unmarshal(b, &list); err != nil || list == nil {
+		return nil, errNotArray
+	}
+	return rawList(list), nil
+}
+
+func (c cborCodec) UnmarshalObject(b []byte) (map[string][]byte, error) {
+	var m map[string]cbor.RawMessage
+	if err := c.dec.Unmarshal(b, &m); err != nil || m == nil {
+		return nil, errNotObject
+	}
+	return rawMap(m), nil
+}
+
+var (
+	errNotArray  = errors.New("rpc: 数据不是数组")
+	errNotObject = errors.New("rpc: 数据不是对象")
+)
+
+// rawList 将各编码的原始数据类型转换为 []byte
+func rawList[T ~[]byte](list []T) [][]byte {
+	res := make([][]byte, len(list))
+	for i, v := range list {
+		res[i] = v
+	}
+	return res
+}
+
+func rawMap[T ~[]byte](m map[string]T) map[string][]byte {
+	res := make(map[string][]byte, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
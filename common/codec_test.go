@@ -0,0 +1,82 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type codecResponse struct {
+	Id     interface{} `json:"id"`
+	Result int         `json:"result"`
+	Error  *Error      `json:"error"`
+}
+
+func handleCodec(t *testing.T, svr *Server, c Codec, req interface{}) codecResponse {
+	t.Helper()
+	b, err := c.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res codecResponse
+	if err = c.Unmarshal(svr.HandlerCodec(context.Background(), c, b), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestHandlerCodec(t *testing.T) {
+	svr := newBenchServer(t)
+	for _, c := range []Codec{MsgPack, CBOR} {
+		t.Run(c.Name(), func(t *testing.T) {
+			params := map[string]interface{}{"a": 1, "b": 2}
+			// 数字 id 原样返回
+			res := handleCodec(t, svr, c, map[string]interface{}{"jsonrpc": "2.0", "id": uint64(1<<63 + 1), "method": "arith.add", "params": params})
+			if res.Error != nil || res.Result != 3 || res.Id != uint64(1<<63+1) {
+				t.Errorf("numeric id: %+v", res)
+			}
+			res = handleCodec(t, svr, c, map[string]interface{}{"jsonrpc": "2.0", "id": nil, "method": "arith.add", "params": params})
+			if res.Error != nil || res.Result != 3 || res.Id != nil {
+				t.Errorf("null id: %+v", res)
+			}
+			res = handleCodec(t, svr, c, map[string]interface{}{"jsonrpc": "2.0", "id": "1", "method": "arith.add", "params": []interface{}{"x"}})
+			if res.Error == nil || res.Error.Code != InvalidParams {
+				t.Errorf("invalid params: %+v", res)
+			}
+			res = handleCodec(t, svr, c, map[string]interface{}{"jsonrpc": "2.0", "id": "1", "params": params})
+			if res.Error == nil || res.Error.Code != InvalidRequest {
+				t.Errorf("missing method: %+v", res)
+			}
+			res = handleCodec(t, svr, c, "not a request")
+			if res.Error == nil || res.Error.Code != ParseError {
+				t.Errorf("not an object: %+v", res)
+			}
+		})
+	}
+}
+
+// json 以外的编码按 params 的 json 格式校验签名
+func TestHandlerCodecSign(t *testing.T) {
+	svr := newBenchServer(t)
+	svr.SetSign(SignOptions{
+		Secret: func(ctx context.Context, key string) (string, error) {
+			return "s3cret-" + key, nil
+		},
+		MaxSkew:  time.Minute,
+		Required: true,
+	})
+	signer := &Signer{Key: "app1", Secret: "s3cret-app1"}
+	for _, c := range []Codec{MsgPack, CBOR} {
+		b, err := EncodeRequest(context.Background(), c, Rs("1", "arith.add", map[string]interface{}{"a": 1, "b": 2.5}), signer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res codecResponse
+		if err = c.Unmarshal(svr.HandlerCodec(context.Background(), c, b), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Error == nil || res.Error.Code != InvalidParams {
+			t.Errorf("%s: signed request %+v, want invalid params after verification", c.Name(), res)
+		}
+	}
+}
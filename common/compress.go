@@ -0,0 +1,169 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressThreshold 默认的压缩阈值，小于该长度的消息不压缩
+const DefaultCompressThreshold = 1024
+
+// CompressThreshold 返回有效的压缩阈值，不大于 0 时使用默认值
+func CompressThreshold(threshold int) int {
+	if threshold <= 0 {
+		return DefaultCompressThreshold
+	}
+	return threshold
+}
+
+// Compressor 消息压缩算法，名称与 http 请求头 Content-Encoding 一致
+type Compressor interface {
+	Name() string                                     // 算法名称
+	Compress(b []byte) ([]byte, error)                // 压缩
+	Decompress(b []byte, limit int64) ([]byte, error) // 解压，解压后超过 limit 时返回错误，limit 不大于 0 时不限制
+}
+
+var (
+	Gzip Compressor = gzipCompressor{}    // gzip 压缩
+	Zstd Compressor = newZstdCompressor() // zstd 压缩
+)
+
+var (
+	compressors   = sync.Map{}
+	compressorSeq []string // 注册顺序，协商时按该顺序优先选择
+	compressorMu  sync.Mutex
+)
+
+func init() {
+	RegisterCompressor(Zstd)
+	RegisterCompressor(Gzip)
+}
+
+// RegisterCompressor 注册压缩算法，先注册的算法在协商时优先
+func RegisterCompressor(c Compressor) {
+	compressorMu.Lock()
+	defer compressorMu.Unlock()
+	if _, ok := compressors.Load(c.Name()); !ok {
+		compressorSeq = append(compressorSeq, c.Name())
+	}
+	compressors.Store(c.Name(), c)
+}
+
+// GetCompressor 按名称查找压缩算法，名称不区分大小写
+func GetCompressor(name string) (Compressor, bool) {
+	c, ok := compressors.Load(strings.ToLower(strings.TrimSpace(name)))
+	if !ok {
+		return nil, false
+	}
+	return c.(Compressor), true
+}
+
+// AcceptEncoding 返回所有已注册的压缩算法，用作 http 请求头 Accept-Encoding
+func AcceptEncoding() string {
+	compressorMu.Lock()
+	defer compressorMu.Unlock()
+	return strings.Join(compressorSeq, ", ")
+}
+
+// NegotiateCompressor 根据 http 请求头 Accept-Encoding 选择压缩算法，按注册顺序优先，忽略 q=0 的算法
+func NegotiateCompressor(accept string) (Compressor, bool) {
+	accepted := make(map[string]bool)
+	for _, item := range strings.Split(accept, ",") {
+		parts := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+		q := true
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				v, err := strconv.ParseFloat(p[2:], 64)
+				q = err == nil && v > 0
+			}
+		}
+		accepted[name] = q
+	}
+	compressorMu.Lock()
+	seq := append([]string(nil), compressorSeq...)
+	compressorMu.Unlock()
+	for _, name := range seq {
+		if ok, found := accepted[name]; (found && ok) || (!found && accepted["*"]) {
+			return GetCompressor(name)
+		}
+	}
+	return nil, false
+}
+
+// readLimit 读取解压后的数据，超过 limit 时返回错误，避免压缩炸弹耗尽内存
+func readLimit(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("rpc: 解压后的消息长度超过限制 %d", limit)
+	}
+	return b, nil
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(b []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	return readLimit(r, limit)
+}
+
+type zstdCompressor struct {
+	enc *zstd.Encoder // EncodeAll 可以并发调用
+}
+
+func newZstdCompressor() Compressor {
+	enc, _ := zstd.NewWriter(nil)
+	return zstdCompressor{enc: enc}
+}
+
+func (zstdCompressor) Name() string { return "zstd" }
+
+func (c zstdCompressor) Compress(b []byte) ([]byte, error) {
+	return c.enc.EncodeAll(b, nil), nil
+}
+
+func (zstdCompressor) Decompress(b []byte, limit int64) ([]byte, error) {
+	r, err := zstd.NewReader(bytes.NewReader(b), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimit(r, limit)
+}
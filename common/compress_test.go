@@ -0,0 +1,97 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestCompressorRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"jsonrpc":"2.0","method":"arith.add"}`), 100)
+	for _, c := range []Compressor{Gzip, Zstd} {
+		t.Run(c.Name(), func(t *testing.T) {
+			b, err := c.Compress(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) >= len(data) {
+				t.Errorf("compressed %d bytes, want less than %d", len(b), len(data))
+			}
+			out, err := c.Decompress(b, int64(len(data)))
+			if err != nil || !bytes.Equal(out, data) {
+				t.Fatalf("decompress = %d bytes, %v", len(out), err)
+			}
+			// 解压后超过限制时拒绝，避免压缩炸弹
+			if _, err = c.Decompress(b, int64(len(data))-1); err == nil {
+				t.Error("want error when decompressed data exceeds the limit")
+			}
+			if out, err = c.Decompress(b, 0); err != nil || !bytes.Equal(out, data) {
+				t.Errorf("decompress without limit = %d bytes, %v", len(out), err)
+			}
+		})
+	}
+}
+
+func TestFramerCompress(t *testing.T) {
+	small := []byte(`{"id":"1"}`)
+	large := []byte(strings.Repeat(`{"id":"1"}`, 200))
+	for _, c := range []Compressor{Gzip, Zstd} {
+		t.Run(c.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewFramer(nil, "", true, 0)
+			w.SetCompressor(c, 1024)
+
+			// 小于阈值的消息不压缩，包头与 hyperf 兼容
+			frame, err := w.Pack(small)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header := binary.BigEndian.Uint32(frame); header != uint32(len(small)) {
+				t.Errorf("small header = %#x, want %#x", header, len(small))
+			}
+			buf.Write(frame)
+
+			// 达到阈值的消息压缩后在包头最高位设置压缩标记
+			if frame, err = w.Pack(large); err != nil {
+				t.Fatal(err)
+			}
+			header := binary.BigEndian.Uint32(frame)
+			if header&PackageCompressFlag == 0 || int(header&^PackageCompressFlag) != len(frame)-PackageHeaderLength {
+				t.Errorf("large header = %#x, frame %d bytes", header, len(frame))
+			}
+			buf.Write(frame)
+
+			r := NewFramer(&buf, "", true, int64(len(large)))
+			r.SetCompressor(c, 1024)
+			for _, want := range [][]byte{small, large} {
+				b, err := r.ReadFrame()
+				if err != nil || !bytes.Equal(b, want) {
+					t.Fatalf("read frame = %d bytes, %v, want %d bytes", len(b), err, len(want))
+				}
+			}
+		})
+	}
+}
+
+// 压缩后的包体没有超过限制，但解压后超过时拒绝
+func TestFramerDecompressLimit(t *testing.T) {
+	large := []byte(strings.Repeat("a", 4096))
+	w := NewFramer(nil, "", true, 0)
+	w.SetCompressor(Zstd, 1024)
+	frame, err := w.Pack(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewFramer(bytes.NewReader(frame), "", true, 1024)
+	r.SetCompressor(Zstd, 1024)
+	if _, err = r.ReadFrame(); err == nil || !strings.Contains(err.Error(), "超过限制") {
+		t.Errorf("read frame error = %v, want limit exceeded", err)
+	}
+
+	// 未设置压缩算法时不能解析带压缩标记的消息
+	r = NewFramer(bytes.NewReader(frame), "", true, 0)
+	if _, err = r.ReadFrame(); err == nil {
+		t.Error("want error for compressed frame without compressor")
+	}
+}
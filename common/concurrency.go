@@ -0,0 +1,129 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Concurrency 并发限制，超过 Max 的调用进入等待队列，队列已满或等待超时的调用立即返回 Overloaded 错误
+type Concurrency struct {
+	Max          int           // 最大并发数，不大于 0 时不限制
+	Queue        int           // 等待队列长度，为 0 时超过并发数立即拒绝
+	QueueTimeout time.Duration // 最长等待时间，为 0 时等待到请求取消
+}
+
+// Semaphore 带等待队列的信号量
+type Semaphore struct {
+	sem     chan struct{}
+	queue   int64
+	timeout time.Duration
+	waiting int64
+}
+
+// NewSemaphore 按并发限制创建信号量，不限制并发时返回 nil
+func NewSemaphore(c Concurrency) *Semaphore {
+	if c.Max <= 0 {
+		return nil
+	}
+	return &Semaphore{sem: make(chan struct{}, c.Max), queue: int64(c.Queue), timeout: c.QueueTimeout}
+}
+
+// Acquire 获取一个并发名额，队列已满、等待超时或请求取消时返回 false，nil 信号量不限制
+func (s *Semaphore) Acquire(ctx context.Context) bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	default:
+	}
+	// 排队的调用超过队列长度时直接拒绝，避免请求堆积
+	if atomic.AddInt64(&s.waiting, 1) > s.queue {
+		atomic.AddInt64(&s.waiting, -1)
+		return false
+	}
+	defer atomic.AddInt64(&s.waiting, -1)
+	var timeout <-chan time.Time
+	if s.timeout > 0 {
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-timeout:
+		return false
+	}
+}
+
+// Release 释放一个并发名额
+func (s *Semaphore) Release() {
+	if s != nil {
+		<-s.sem
+	}
+}
+
+// InFlight 返回正在执行的调用数
+func (s *Semaphore) InFlight() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.sem)
+}
+
+// Waiting 返回正在排队的调用数
+func (s *Semaphore) Waiting() int {
+	if s == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&s.waiting))
+}
+
+// SetConcurrency 限制所有方法同时执行的调用数
+func (svr *Server) SetConcurrency(c Concurrency) {
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	svr.inFlight.Store(semaphore{NewSemaphore(c)})
+}
+
+// SetMethodConcurrency 限制单个方法同时执行的调用数，方法名支持别名与各种命名风格，需要在注册服务后调用
+func (svr *Server) SetMethodConcurrency(method string, c Concurrency) error {
+	svc, m, ok := svr.Lookup(method)
+	if !ok {
+		return fmt.Errorf("rpc: 方法 %s 不存在", method)
+	}
+	svr.methodConcurrency.Store(svc.Name+"."+m.Name, NewSemaphore(c))
+	return nil
+}
+
+// semaphore 包装可能为 nil 的信号量，atomic.Value 不能存储 nil
+type semaphore struct {
+	s *Semaphore
+}
+
+// acquire 依次获取方法与全局的并发名额，失败时释放已获取的名额，成功时返回释放函数
+// 先获取方法的名额，在方法队列中等待的调用不占用全局名额，避免单个繁忙的方法占满全局名额
+func (svr *Server) acquire(ctx context.Context, svc *Service, m *Method) (func(), bool) {
+	var method *Semaphore
+	if v, ok := svr.methodConcurrency.Load(svc.Name + "." + m.Name); ok {
+		method = v.(*Semaphore)
+	}
+	if !method.Acquire(ctx) {
+		return nil, false
+	}
+	global, _ := svr.inFlight.Load().(semaphore)
+	if !global.s.Acquire(ctx) {
+		method.Release()
+		return nil, false
+	}
+	return func() {
+		global.s.Release()
+		method.Release()
+	}, true
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type slowService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowService) Slow(args *benchArgs, result *int) error {
+	s.started <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func (s *slowService) Fast(args *benchArgs, result *int) error {
+	*result = args.A + args.B
+	return nil
+}
+
+// 在方法队列中等待的调用不应占用全局名额
+func TestQueuedMethodDoesNotStarveOthers(t *testing.T) {
+	svc := &slowService{started: make(chan struct{}, 2), release: make(chan struct{})}
+	svr := &Server{}
+	if err := svr.RegisterName("svc", svc); err != nil {
+		t.Fatal(err)
+	}
+	svr.SetConcurrency(Concurrency{Max: 2})
+	if err := svr.SetMethodConcurrency("svc.slow", Concurrency{Max: 1, Queue: 10}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	done := make(chan []byte, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			done <- svr.HandlerContext(ctx, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":"%d","method":"svc.slow"}`, i)))
+		}(i)
+	}
+	<-svc.started
+	// 等待第二个调用进入方法队列
+	deadline := time.Now().Add(time.Second)
+	for {
+		v, _ := svr.methodConcurrency.Load("svc.Slow")
+		if v.(*Semaphore).Waiting() == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("second slow call not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	res := svr.HandlerContext(ctx, []byte(`{"jsonrpc":"2.0","id":"f","method":"svc.fast","params":{"a":1,"b":2}}`))
+	if code := responseCode(t, res); code != WithoutError {
+		t.Errorf("fast call code = %d: %s", code, res)
+	}
+	close(svc.release)
+	for i := 0; i < 2; i++ {
+		if code := responseCode(t, <-done); code != WithoutError {
+			t.Errorf("slow call code = %d", code)
+		}
+	}
+}
+
+func TestSemaphoreQueue(t *testing.T) {
+	s := NewSemaphore(Concurrency{Max: 1, Queue: 1, QueueTimeout: 20 * time.Millisecond})
+	ctx := context.Background()
+	if !s.Acquire(ctx) {
+		t.Fatal("first acquire failed")
+	}
+	// 队列中等待超时
+	start := time.Now()
+	if s.Acquire(ctx) {
+		t.Fatal("acquire over max succeeded")
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("returned after %s, want queue timeout", d)
+	}
+	s.Release()
+	if !s.Acquire(ctx) {
+		t.Error("acquire after release failed")
+	}
+}
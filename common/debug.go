@@ -1,10 +1,16 @@
 package common
 
 import (
-	"github.com/gogf/gf/v2/os/gctx"
-	"github.com/gogf/gf/v2/os/glog"
+	"context"
+	"fmt"
 )
 
+// Debug 通过默认日志输出调试信息，没有请求上下文时使用
 func Debug(msg interface{}) {
-	glog.Debug(gctx.New(), msg)
+	DebugContext(context.Background(), msg)
+}
+
+// DebugContext 通过默认日志输出调试信息，ctx 为请求的上下文，日志中可以关联请求的链路
+func DebugContext(ctx context.Context, msg interface{}) {
+	GetLogger().Log(ctx, LevelDebug, fmt.Sprint(msg))
 }
@@ -1,5 +1,10 @@
 package common
 
+import (
+	"fmt"
+	"strings"
+)
+
 /**
  * 消息错误提示
  */
@@ -13,6 +18,10 @@ const (
 	InternalError     = -32603 // 内部调用错误
 	ProcedureIsMethod = -32604 // 内部错误，请求未提供id字段
 	CustomError       = -32000 // 服务端错误
+	RateLimited       = -32001 // 请求次数过多，data 中返回建议的等待秒数
+	Overloaded        = -32002 // 服务繁忙，超过并发限制并且排队失败
+	Unauthorized      = -32003 // 未认证或认证失败，data 中返回原因
+	Forbidden         = -32004 // 调用方没有访问该方法的权限
 )
 
 var CodeMap = map[int]string{
@@ -24,4 +33,32 @@ var CodeMap = map[int]string{
 	InternalError:     "内部调用错误",
 	ProcedureIsMethod: "内部错误，请求未提供id字段",
 	CustomError:       "服务端内部错误",
+	RateLimited:       "请求次数过多，请稍候再试",
+	Overloaded:        "服务繁忙，请稍候再试",
+	Unauthorized:      "认证失败",
+	Forbidden:         "没有访问权限",
+}
+
+// MethodError 方法因签名不符合要求无法注册
+type MethodError struct {
+	Method string // 方法名
+	Reason string // 原因
+}
+
+func (e *MethodError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Method, e.Reason)
+}
+
+// RegisterError 服务注册失败，列出所有签名不符合要求的方法
+type RegisterError struct {
+	Service string
+	Methods []*MethodError
+}
+
+func (e *RegisterError) Error() string {
+	msg := make([]string, 0, len(e.Methods))
+	for _, m := range e.Methods {
+		msg = append(msg, m.Error())
+	}
+	return fmt.Sprintf("服务 %s 注册失败，以下方法签名不符合要求：%s", e.Service, strings.Join(msg, "；"))
 }
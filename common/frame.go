@@ -0,0 +1,132 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PackageHeaderLength 长度检测协议的包头长度，与 hyperf jsonrpc-tcp-length-check 一致
+// 包头为 4 字节大端序的包体长度 package_length_type N
+const PackageHeaderLength = 4
+
+// PackageCompressFlag 包头最高位标记包体已压缩，其余 31 位为包体长度，未压缩的消息与 hyperf 保持兼容
+const PackageCompressFlag uint32 = 1 << 31
+
+// CheckFraming 二进制编码与压缩后的消息中可能出现结束符，只能使用长度检测协议
+func CheckFraming(codec Codec, compressor Compressor, lengthCheck bool) error {
+	if lengthCheck {
+		return nil
+	}
+	if !IsJSON(codec) {
+		return fmt.Errorf("rpc: %s 编码需要开启 PackageLengthCheck 长度检测协议", codec.Name())
+	}
+	if compressor != nil {
+		return fmt.Errorf("rpc: %s 压缩需要开启 PackageLengthCheck 长度检测协议", compressor.Name())
+	}
+	return nil
+}
+
+// Framer 拆分 tcp 连接中的消息，支持结束符分隔与长度检测两种协议
+type Framer struct {
+	r           io.Reader
+	eof         []byte
+	lengthCheck bool
+	maxLength   int64
+	buf         []byte
+	compressor  Compressor
+	threshold   int
+}
+
+// NewFramer 创建消息拆分器，lengthCheck 为 true 时使用长度检测协议，否则使用 eof 分隔
+func NewFramer(r io.Reader, eof string, lengthCheck bool, maxLength int64) *Framer {
+	return &Framer{r: r, eof: []byte(eof), lengthCheck: lengthCheck, maxLength: maxLength}
+}
+
+// SetCompressor 设置压缩算法，长度不小于 threshold 的消息压缩后发送，收到带压缩标记的消息时解压
+// 需要配合长度检测协议使用，通信双方的压缩算法需要一致
+func (f *Framer) SetCompressor(c Compressor, threshold int) {
+	f.compressor, f.threshold = c, threshold
+}
+
+// ReadFrame 读取一条完整的消息，多读取的数据保留到下一次读取
+func (f *Framer) ReadFrame() ([]byte, error) {
+	for {
+		if b, ok, err := f.next(); ok || err != nil {
+			return b, err
+		}
+		var buf = make([]byte, 4096)
+		n, err := f.r.Read(buf)
+		f.buf = append(f.buf, buf[:n]...)
+		if err != nil && n == 0 {
+			return nil, err
+		}
+		if f.maxLength > 0 && int64(len(f.buf)) > f.maxLength+PackageHeaderLength+int64(len(f.eof)) {
+			return nil, fmt.Errorf("rpc: 消息长度超过限制 %d", f.maxLength)
+		}
+	}
+}
+
+// next 从缓冲区中取出一条完整的消息
+func (f *Framer) next() ([]byte, bool, error) {
+	if !f.lengthCheck {
+		i := bytes.Index(f.buf, f.eof)
+		if i < 0 {
+			return nil, false, nil
+		}
+		b := f.buf[:i]
+		f.buf = f.buf[i+len(f.eof):]
+		return b, true, nil
+	}
+	if len(f.buf) < PackageHeaderLength {
+		return nil, false, nil
+	}
+	header := binary.BigEndian.Uint32(f.buf)
+	l := int64(header &^ PackageCompressFlag)
+	if f.maxLength > 0 && l > f.maxLength {
+		return nil, false, fmt.Errorf("rpc: 消息长度超过限制 %d", f.maxLength)
+	}
+	if int64(len(f.buf)) < PackageHeaderLength+l {
+		return nil, false, nil
+	}
+	b := f.buf[PackageHeaderLength : PackageHeaderLength+l]
+	f.buf = f.buf[PackageHeaderLength+l:]
+	if header&PackageCompressFlag == 0 {
+		return b, true, nil
+	}
+	if f.compressor == nil {
+		return nil, false, errors.New("rpc: 收到压缩的消息，但未设置压缩算法")
+	}
+	b, err := f.compressor.Decompress(b, f.maxLength)
+	return b, err == nil, err
+}
+
+// Pack 按协议封装一条消息，设置了压缩算法且长度达到阈值时压缩后添加压缩标记
+func (f *Framer) Pack(b []byte) ([]byte, error) {
+	if f.compressor == nil || !f.lengthCheck || len(b) < f.threshold {
+		return PackFrame(b, string(f.eof), f.lengthCheck), nil
+	}
+	cb, err := f.compressor.Compress(b)
+	if err != nil {
+		return nil, err
+	}
+	// 压缩后没有变小时原样发送
+	if len(cb) >= len(b) {
+		return PackFrame(b, string(f.eof), f.lengthCheck), nil
+	}
+	frame := PackFrame(cb, "", true)
+	frame[0] |= byte(PackageCompressFlag >> 24)
+	return frame, nil
+}
+
+// PackFrame 按协议封装一条消息，长度检测协议添加包头，否则在末尾追加结束符
+func PackFrame(b []byte, eof string, lengthCheck bool) []byte {
+	if !lengthCheck {
+		return append(b, eof...)
+	}
+	frame := make([]byte, PackageHeaderLength, PackageHeaderLength+len(b))
+	binary.BigEndian.PutUint32(frame, uint32(len(b)))
+	return append(frame, b...)
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 健康检查内置方法
+const (
+	PingMethod   = "rpc.ping"   // 存活检测，返回 pong
+	HealthMethod = "rpc.health" // 健康检查，返回 Health
+)
+
+// 健康状态
+const (
+	StatusOK       = "ok"        // 已就绪并且所有检查通过
+	StatusFail     = "fail"      // 存在未通过的检查
+	StatusNotReady = "not_ready" // 未就绪，如正在关闭
+)
+
+// HealthTimeout 上下文没有设置超时时间时单次健康检查的超时时间
+var HealthTimeout = 3 * time.Second
+
+// HealthCheck 健康检查，返回错误时表示依赖不可用，需要在 ctx 取消后尽快返回
+type HealthCheck func(ctx context.Context) error
+
+// Health 健康检查结果
+type Health struct {
+	Status string                 `json:"status"`           // ok、fail 或 not_ready
+	Ready  bool                   `json:"ready"`            // 是否接收新的请求，关闭时为 false
+	Checks map[string]CheckResult `json:"checks,omitempty"` // 每个检查的结果
+}
+
+// CheckResult 单个检查的结果
+type CheckResult struct {
+	Status   string `json:"status"` // ok 或 fail
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// OK 是否已就绪并且所有检查通过
+func (h *Health) OK() bool {
+	return h.Status == StatusOK
+}
+
+// AddHealthCheck 添加健康检查，同名的检查会被替换，rpc.health 与 http 的 /readyz 执行所有检查
+func (svr *Server) AddHealthCheck(name string, check HealthCheck) {
+	svr.healthChecks.Store(name, check)
+}
+
+// SetReady 设置是否就绪，关闭服务时自动设置为未就绪
+func (svr *Server) SetReady(ready bool) {
+	var v int32
+	if !ready {
+		v = 1
+	}
+	atomic.StoreInt32(&svr.notReady, v)
+}
+
+// Ready 是否就绪
+func (svr *Server) Ready() bool {
+	return atomic.LoadInt32(&svr.notReady) == 0
+}
+
+// Health 并发执行所有健康检查
+func (svr *Server) Health(ctx context.Context) *Health {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, HealthTimeout)
+		defer cancel()
+	}
+	h := &Health{Status: StatusOK, Ready: svr.Ready()}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	svr.healthChecks.Range(func(k, v interface{}) bool {
+		name, check := k.(string), v.(HealthCheck)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := runCheck(ctx, check)
+			r := CheckResult{Status: StatusOK, Duration: time.Since(start).Round(time.Microsecond).String()}
+			if err != nil {
+				r.Status, r.Error = StatusFail, err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if h.Checks == nil {
+				h.Checks = make(map[string]CheckResult)
+			}
+			h.Checks[name] = r
+		}()
+		return true
+	})
+	wg.Wait()
+	for _, r := range h.Checks {
+		if r.Status != StatusOK {
+			h.Status = StatusFail
+			break
+		}
+	}
+	if h.Status == StatusOK && !h.Ready {
+		h.Status = StatusNotReady
+	}
+	return h
+}
+
+// runCheck 执行检查，检查没有响应超时时同样返回错误
+func runCheck(ctx context.Context, check HealthCheck) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isBuiltin 是否为内置方法
+func isBuiltin(method string) bool {
+	switch method {
+	case DiscoverMethod, PingMethod, HealthMethod:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,313 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/os/glog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	}
+	return "error"
+}
+
+// Field 结构化日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger 日志接口，可以接入 zap、zerolog 等日志库
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// NewGLogger 基于 goframe glog 的日志，字段以 key=value 的格式追加到消息后，l 为 nil 时使用 glog 的默认实例
+func NewGLogger(l *glog.Logger) Logger {
+	return &gLogger{l: l}
+}
+
+type gLogger struct {
+	l *glog.Logger
+}
+
+func (g *gLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	l := g.l
+	if l == nil {
+		l = glog.DefaultLogger()
+	}
+	line := msg + FormatFields(fields)
+	switch level {
+	case LevelDebug:
+		l.Debug(ctx, line)
+	case LevelInfo:
+		l.Info(ctx, line)
+	case LevelWarn:
+		l.Warning(ctx, line)
+	default:
+		l.Error(ctx, line)
+	}
+}
+
+// FormatFields 以 key=value 的格式输出字段，包含空白、引号或等号的值加上引号
+func FormatFields(fields []Field) string {
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		s := fmt.Sprint(f.Value)
+		if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+var logger atomic.Value
+
+type loggerHolder struct {
+	l Logger
+}
+
+// SetLogger 设置默认日志，Debug 输出的调试信息与未指定日志的访问日志使用该日志，为 nil 时恢复为 glog
+func SetLogger(l Logger) {
+	logger.Store(loggerHolder{l})
+}
+
+// GetLogger 返回默认日志
+func GetLogger() Logger {
+	if h, _ := logger.Load().(loggerHolder); h.l != nil {
+		return h.l
+	}
+	return defaultLogger
+}
+
+var defaultLogger = NewGLogger(nil)
+
+// DefaultRedact 默认脱敏的参数字段
+var DefaultRedact = []string{"password", "passwd", "secret", "token", "authorization", "apikey", "api_key"}
+
+// LogOptions 访问日志配置
+type LogOptions struct {
+	Logger    Logger   // 日志，为 nil 时使用 GetLogger()
+	AccessLog bool     // 每个请求输出一条访问日志，批量请求中每个元素输出一条
+	Params    bool     // 访问日志中记录请求参数，Redact 中的字段脱敏后输出
+	Redact    []string // 脱敏的参数字段，不区分大小写，如 password 匹配任意层级的字段，user.token 匹配完整路径，为 nil 时使用 DefaultRedact
+}
+
+func (o *LogOptions) logger() Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return GetLogger()
+}
+
+// SetLog 设置服务端访问日志
+func (svr *Server) SetLog(o LogOptions) {
+	svr.log.Store(&o)
+}
+
+func (svr *Server) logOptions() *LogOptions {
+	o, _ := svr.log.Load().(*LogOptions)
+	return o
+}
+
+// accessLog 输出服务端的访问日志
+func (svr *Server) accessLog(o *LogOptions, info *callInfo, res interface{}, d time.Duration) {
+	ctx := info.ctx
+	fields := make([]Field, 0, 12)
+	if peer := PeerFromContext(ctx); peer != nil {
+		fields = append(fields, Field{"transport", peer.Transport}, Field{"remote", peer.RemoteAddr})
+	}
+	req := info.req
+	if req.Id != nil {
+		fields = append(fields, Field{"id", req.Id})
+	}
+	fields = append(fields, Field{"method", req.Method})
+	if i, ok := BatchIndexFromContext(ctx); ok {
+		fields = append(fields, Field{"batch", i})
+	}
+	fields = append(fields, Field{"duration", d.Round(time.Microsecond)})
+	level := LevelInfo
+	code := WithoutError
+	if e := responseError(res); e != nil {
+		level, code = LevelWarn, e.Code
+		fields = append(fields, Field{"code", code}, Field{"error", e.Message})
+	} else {
+		fields = append(fields, Field{"code", code})
+	}
+	if p := PrincipalFromContext(ctx); p != nil {
+		fields = append(fields, Field{"principal", p.Id})
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		fields = append(fields, Field{"trace_id", sc.TraceID().String()})
+	}
+	if o.Params && len(req.Params) > 0 {
+		if params, err := req.jsonParams(); err == nil {
+			fields = append(fields, Field{"params", string(redactParams(params, o.redact(), positionalNames(info.method)))})
+		}
+	}
+	o.logger().Log(ctx, level, "rpc access", fields...)
+}
+
+// ClientLog 输出客户端的访问日志，index 为批量请求中的位置，单个请求为 -1
+func (o *LogOptions) ClientLog(ctx context.Context, addr string, method string, params interface{}, index int, d time.Duration, err error) {
+	if o == nil || !o.AccessLog {
+		return
+	}
+	fields := []Field{{"remote", addr}, {"method", method}}
+	if index >= 0 {
+		fields = append(fields, Field{"batch", index})
+	}
+	fields = append(fields, Field{"duration", d.Round(time.Microsecond)})
+	level := LevelInfo
+	switch e := err.(type) {
+	case nil:
+		fields = append(fields, Field{"code", WithoutError})
+	case *Error:
+		level = LevelWarn
+		fields = append(fields, Field{"code", e.Code}, Field{"error", e.Message})
+	default:
+		level = LevelWarn
+		fields = append(fields, Field{"error", err.Error()})
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		fields = append(fields, Field{"trace_id", sc.TraceID().String()})
+	}
+	if o.Params && params != nil {
+		if b, err := json.Marshal(StructuredParams(params)); err == nil {
+			fields = append(fields, Field{"params", string(RedactParams(b, o.redact()))})
+		}
+	}
+	o.logger().Log(ctx, level, "rpc call", fields...)
+}
+
+func (o *LogOptions) redact() []string {
+	if o.Redact == nil {
+		return DefaultRedact
+	}
+	return o.Redact
+}
+
+// RedactParams 将参数中匹配的字段替换为 ***，无法解析的参数原样返回
+func RedactParams(params json.RawMessage, fields []string) json.RawMessage {
+	return redactParams(params, fields, nil)
+}
+
+// redactParams 脱敏请求参数，names 为按位置传递时每个位置对应的字段名，与对象参数使用相同的规则
+func redactParams(params json.RawMessage, fields []string, names []string) json.RawMessage {
+	if len(fields) == 0 || isNull(params) {
+		return params
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return params
+	}
+	rules := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		rules[strings.ToLower(f)] = true
+	}
+	if list, ok := v.([]interface{}); ok && len(names) > 0 {
+		for i, item := range list {
+			if i >= len(names) {
+				break
+			}
+			key := strings.ToLower(names[i])
+			if rules[key] {
+				list[i] = "***"
+				continue
+			}
+			list[i] = redactValue(item, key, rules)
+		}
+	} else {
+		v = redactValue(v, "", rules)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return params
+	}
+	return b
+}
+
+// positionalNames 返回按位置传递参数时每个位置对应的字段名，顺序与 bindPositional 一致，参数不是结构体时返回 nil
+func positionalNames(m *Method) []string {
+	if m == nil || m.ParamsType == nil {
+		return nil
+	}
+	t := indirectParams(m.ParamsType)
+	if t.Kind() != reflect.Struct || isJSONType(reflect.New(t).Elem()) {
+		return nil
+	}
+	fields := structFields(t)
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+func redactValue(v interface{}, path string, rules map[string]bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			key := strings.ToLower(k)
+			full := key
+			if path != "" {
+				full = path + "." + key
+			}
+			if rules[key] || rules[full] {
+				t[k] = "***"
+				continue
+			}
+			t[k] = redactValue(item, full, rules)
+		}
+	case []interface{}:
+		for i, item := range t {
+			t[i] = redactValue(item, path, rules)
+		}
+	}
+	return v
+}
+
+type batchIndexKey struct{}
+
+// withBatchIndex 记录请求在批量请求中的位置
+func withBatchIndex(ctx context.Context, i int) context.Context {
+	return context.WithValue(ctx, batchIndexKey{}, i)
+}
+
+// BatchIndexFromContext 返回请求在批量请求中的位置，不是批量请求时返回 false
+func BatchIndexFromContext(ctx context.Context) (int, bool) {
+	i, ok := ctx.Value(batchIndexKey{}).(int)
+	return i, ok
+}
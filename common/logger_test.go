@@ -0,0 +1,109 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logEntry struct {
+	ctx    context.Context
+	level  Level
+	msg    string
+	fields []Field
+}
+
+type memoryLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *memoryLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{ctx, level, msg, fields})
+}
+
+func (l *memoryLogger) field(key string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, f := range l.entries[len(l.entries)-1].fields {
+		if f.Key == key {
+			return f.Value.(string)
+		}
+	}
+	return ""
+}
+
+type loginService struct{}
+
+type loginArgs struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Device   struct {
+		Token string `json:"token"`
+		Model string `json:"model"`
+	} `json:"device"`
+}
+
+func (loginService) Login(args *loginArgs, result *string) error {
+	*result = args.Name
+	return nil
+}
+
+func TestAccessLogRedactsPositionalParams(t *testing.T) {
+	svr := &Server{}
+	if err := svr.RegisterName("user", loginService{}); err != nil {
+		t.Fatal(err)
+	}
+	l := &memoryLogger{}
+	svr.SetLog(LogOptions{AccessLog: true, Params: true, Logger: l, Redact: []string{"password", "device.token"}})
+	ctx := context.Background()
+
+	cases := map[string]string{
+		`{"jsonrpc":"2.0","id":"1","method":"user.login","params":{"name":"bob","password":"p","device":{"token":"t","model":"m"}}}`: `{"device":{"model":"m","token":"***"},"name":"bob","password":"***"}`,
+		`{"jsonrpc":"2.0","id":"1","method":"user.login","params":["bob","p",{"token":"t","model":"m"}]}`:                            `["bob","***",{"model":"m","token":"***"}]`,
+		// 多余的位置不对应任何字段，按普通数组处理
+		`{"jsonrpc":"2.0","id":"1","method":"user.nope","params":["bob","p"]}`: `["bob","p"]`,
+	}
+	for req, want := range cases {
+		svr.HandlerContext(ctx, []byte(req))
+		if got := l.field("params"); got != want {
+			t.Errorf("%s: params %s, want %s", req, got, want)
+		}
+	}
+}
+
+func TestRedactParams(t *testing.T) {
+	got := string(RedactParams([]byte(`{"User":{"Token":"t","id":1},"list":[{"password":"p"}]}`), []string{"password", "user.token"}))
+	if want := `{"User":{"Token":"***","id":1},"list":[{"password":"***"}]}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := string(RedactParams([]byte(`{bad`), DefaultRedact)); got != `{bad` {
+		t.Errorf("invalid params changed: %s", got)
+	}
+}
+
+type ctxKey struct{}
+
+func TestDebugUsesContext(t *testing.T) {
+	l := &memoryLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+	DebugContext(ctx, "hello")
+	if len(l.entries) != 1 || l.entries[0].ctx.Value(ctxKey{}) != "req-1" || l.entries[0].level != LevelDebug {
+		t.Fatalf("entries %+v", l.entries)
+	}
+	if !strings.Contains(l.entries[0].msg, "hello") {
+		t.Errorf("msg %q", l.entries[0].msg)
+	}
+
+	// Debug 保持原来的签名，使用 context.Background()
+	Debug(errors.New("bye"))
+	if len(l.entries) != 2 || l.entries[1].ctx.Value(ctxKey{}) != nil || l.entries[1].level != LevelDebug || l.entries[1].msg != "bye" {
+		t.Errorf("entries %+v", l.entries)
+	}
+}
@@ -0,0 +1,177 @@
+package common
+
+import (
+	"strconv"
+	"time"
+)
+
+// BatchBuckets 批量请求大小直方图的分桶
+var BatchBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500}
+
+// UnknownMethod 方法不存在或请求无法解析时指标使用的方法名，避免任意方法名产生大量序列
+const UnknownMethod = "unknown"
+
+// ServerMetrics 服务端指标，方法按 服务名.方法名 统计
+type ServerMetrics struct {
+	Registry    *Registry
+	Requests    *CounterVec   // jsonrpc_server_requests_total{method}
+	Errors      *CounterVec   // jsonrpc_server_errors_total{method,code}
+	Duration    *HistogramVec // jsonrpc_server_request_duration_seconds{method}
+	InFlight    *GaugeVec     // jsonrpc_server_in_flight
+	BatchSize   *HistogramVec // jsonrpc_server_batch_size
+	RateLimited *CounterVec   // jsonrpc_server_rate_limited_total{method}
+	Connections *GaugeVec     // jsonrpc_server_connections{transport}
+}
+
+// NewServerMetrics 在注册表中注册服务端指标，多个服务使用同一个注册表时共享指标
+// 注册表中的同名指标类型或标签不一致时返回错误
+func NewServerMetrics(r *Registry) (*ServerMetrics, error) {
+	var errs metricErrors
+	sm := &ServerMetrics{
+		Registry:    r,
+		Requests:    errs.counter(r.Counter("jsonrpc_server_requests_total", "处理的请求数，批量请求中每个元素计数一次", "method")),
+		Errors:      errs.counter(r.Counter("jsonrpc_server_errors_total", "返回错误的请求数，按 JSON-RPC 错误码区分", "method", "code")),
+		Duration:    errs.histogram(r.Histogram("jsonrpc_server_request_duration_seconds", "请求的处理耗时", nil, "method")),
+		InFlight:    errs.gauge(r.Gauge("jsonrpc_server_in_flight", "正在处理的请求数")),
+		BatchSize:   errs.histogram(r.Histogram("jsonrpc_server_batch_size", "批量请求中的请求数", BatchBuckets)),
+		RateLimited: errs.counter(r.Counter("jsonrpc_server_rate_limited_total", "被限流拒绝的请求数", "method")),
+		Connections: errs.gauge(r.Gauge("jsonrpc_server_connections", "当前保持的连接数", "transport")),
+	}
+	if errs.err != nil {
+		return nil, errs.err
+	}
+	return sm, nil
+}
+
+// metricErrors 记录注册一组指标时的第一个错误
+type metricErrors struct {
+	err error
+}
+
+func (e *metricErrors) add(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *metricErrors) counter(c *CounterVec, err error) *CounterVec {
+	e.add(err)
+	return c
+}
+
+func (e *metricErrors) gauge(g *GaugeVec, err error) *GaugeVec {
+	e.add(err)
+	return g
+}
+
+func (e *metricErrors) histogram(h *HistogramVec, err error) *HistogramVec {
+	e.add(err)
+	return h
+}
+
+// observe 记录单个请求的处理结果
+func (sm *ServerMetrics) observe(method string, res interface{}, d time.Duration) {
+	sm.Requests.Inc(method)
+	sm.Duration.Observe(d.Seconds(), method)
+	e := responseError(res)
+	if e == nil {
+		return
+	}
+	sm.Errors.Inc(method, strconv.Itoa(e.Code))
+	if e.Code == RateLimited {
+		sm.RateLimited.Inc(method)
+	}
+}
+
+// SetMetrics 开启服务端指标，r 为 nil 时关闭，需要在服务启动前调用，注册指标失败时保持原来的设置
+func (svr *Server) SetMetrics(r *Registry) error {
+	var sm *ServerMetrics
+	if r != nil {
+		var err error
+		if sm, err = NewServerMetrics(r); err != nil {
+			return err
+		}
+	}
+	svr.metrics.Store(sm)
+	return nil
+}
+
+// Metrics 返回服务端指标，未开启时返回 nil
+func (svr *Server) Metrics() *ServerMetrics {
+	sm, _ := svr.metrics.Load().(*ServerMetrics)
+	return sm
+}
+
+// metricMethod 指标中的方法名，已注册的方法使用 服务名.方法名，内置方法保持原样
+func metricMethod(method string, svc *Service, m *Method) string {
+	switch {
+	case svc != nil && m != nil:
+		return svc.Name + "." + m.Name
+	case isBuiltin(method) || method == AuthMethod:
+		return method
+	}
+	return UnknownMethod
+}
+
+// ClientMetrics 客户端指标，方法按调用时传入的方法名统计
+type ClientMetrics struct {
+	Registry *Registry
+	Requests *CounterVec   // jsonrpc_client_requests_total{method}
+	Errors   *CounterVec   // jsonrpc_client_errors_total{method,code}
+	Duration *HistogramVec // jsonrpc_client_request_duration_seconds{method}
+	InFlight *GaugeVec     // jsonrpc_client_in_flight
+	Retries  *CounterVec   // jsonrpc_client_retries_total{method}
+}
+
+// NewClientMetrics 在注册表中注册客户端指标，多个客户端使用同一个注册表时共享指标
+// 注册表中的同名指标类型或标签不一致时返回错误
+func NewClientMetrics(r *Registry) (*ClientMetrics, error) {
+	var errs metricErrors
+	cm := &ClientMetrics{
+		Registry: r,
+		Requests: errs.counter(r.Counter("jsonrpc_client_requests_total", "发起的请求数，批量请求中每个元素计数一次", "method")),
+		Errors:   errs.counter(r.Counter("jsonrpc_client_errors_total", "失败的请求数，服务端错误按 JSON-RPC 错误码区分，其它错误为 transport", "method", "code")),
+		Duration: errs.histogram(r.Histogram("jsonrpc_client_request_duration_seconds", "请求的耗时，批量请求中每个元素记录整个批量请求的耗时", nil, "method")),
+		InFlight: errs.gauge(r.Gauge("jsonrpc_client_in_flight", "等待响应的请求数")),
+		Retries:  errs.counter(r.Counter("jsonrpc_client_retries_total", "重试的次数，批量请求的方法为 jsonrpc.batch", "method")),
+	}
+	if errs.err != nil {
+		return nil, errs.err
+	}
+	return cm, nil
+}
+
+// Retried 记录一次重试，cm 为 nil 时不记录
+func (cm *ClientMetrics) Retried(method string) {
+	if cm != nil {
+		cm.Retries.Inc(method)
+	}
+}
+
+// Begin 开始记录一次请求，返回的函数在请求结束时以请求的错误调用，cm 为 nil 时不记录
+func (cm *ClientMetrics) Begin(methods ...string) func(errs ...error) {
+	if cm == nil {
+		return func(...error) {}
+	}
+	start := time.Now()
+	cm.InFlight.Add(float64(len(methods)))
+	return func(errs ...error) {
+		d := time.Since(start).Seconds()
+		cm.InFlight.Add(-float64(len(methods)))
+		for i, method := range methods {
+			cm.Requests.Inc(method)
+			cm.Duration.Observe(d, method)
+			if i < len(errs) && errs[i] != nil {
+				cm.Errors.Inc(method, errorCode(errs[i]))
+			}
+		}
+	}
+}
+
+// errorCode 客户端错误的错误码标签
+func errorCode(err error) string {
+	if e, ok := err.(*Error); ok {
+		return strconv.Itoa(e.Code)
+	}
+	return "transport"
+}
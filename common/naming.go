@@ -0,0 +1,91 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy 服务名与方法名的对外命名策略
+type NamingStrategy int
+
+const (
+	NamingDefault NamingStrategy = iota // 使用 Go 标识符，调用时兼容大驼峰、小驼峰、下划线
+	NamingExact                         // 使用 Go 标识符，调用时区分大小写
+	NamingSnake                         // 下划线 int_rpc.get_user
+	NamingCamel                         // 小驼峰 intRpc.getUser
+	NamingHyperf                        // hyperf 路径 /int_rpc/getUser，服务名去掉 Service 后缀
+)
+
+// ServiceName 根据策略生成服务的对外名称
+func (n NamingStrategy) ServiceName(name string) string {
+	switch n {
+	case NamingSnake:
+		return snake(name)
+	case NamingCamel:
+		return camel(name)
+	case NamingHyperf:
+		if trimmed := strings.TrimSuffix(name, "Service"); trimmed != "" {
+			name = trimmed
+		}
+		return snake(name)
+	}
+	return name
+}
+
+// MethodName 根据策略生成方法的对外名称
+func (n NamingStrategy) MethodName(name string) string {
+	switch n {
+	case NamingSnake:
+		return snake(name)
+	case NamingCamel, NamingHyperf:
+		return camel(name)
+	}
+	return name
+}
+
+// Join 拼接服务名与方法名作为完整的方法名
+func (n NamingStrategy) Join(sName string, mName string) string {
+	if n == NamingHyperf {
+		return "/" + sName + "/" + mName
+	}
+	return sName + "." + mName
+}
+
+// SplitMethod 按最后一个 . 或 / 拆分服务名与方法名，不做大小写转换
+func SplitMethod(method string) (sName string, mName string, err error) {
+	method = strings.TrimLeft(method, "./")
+	sp := strings.LastIndexAny(method, "./")
+	if sp <= 0 || sp == len(method)-1 {
+		return sName, mName, fmt.Errorf("rpc: 方法 %s 请求格式错误; 需要为 x.y or x/y", method)
+	}
+	return method[:sp], method[sp+1:], nil
+}
+
+// snake 大驼峰转下划线，连续的大写字母视为一个单词 GetUserID => get_user_id
+func snake(s string) string {
+	rs := []rune(s)
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]) && unicode.IsUpper(rs[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// camel 首个单词转为小写 GetUser => getUser，IDCard => idCard
+func camel(s string) string {
+	rs := []rune(s)
+	for i := 0; i < len(rs) && unicode.IsUpper(rs[i]); i++ {
+		if i > 0 && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			break
+		}
+		rs[i] = unicode.ToLower(rs[i])
+	}
+	return string(rs)
+}
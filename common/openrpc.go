@@ -0,0 +1,314 @@
+package common
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OpenRPCVersion = "1.2.6"        // 生成文档使用的 OpenRPC 规范版本
+	DiscoverMethod = "rpc.discover" // 服务发现内置方法
+)
+
+// OpenRPC 服务描述文档 https://spec.open-rpc.org
+type OpenRPC struct {
+	OpenRPC    string             `json:"openrpc"`
+	Info       OpenRPCInfo        `json:"info"`
+	Methods    []OpenRPCMethod    `json:"methods"`
+	Components *OpenRPCComponents `json:"components,omitempty"`
+}
+
+// OpenRPCInfo 文档基础信息
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenRPCMethod 方法描述
+type OpenRPCMethod struct {
+	Name           string                 `json:"name"`
+	ParamStructure string                 `json:"paramStructure,omitempty"`
+	Params         []OpenRPCContent       `json:"params"`
+	Result         OpenRPCContent         `json:"result"`
+	Extensions     map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON 将 x- 开头的扩展字段平铺到方法描述中
+func (m OpenRPCMethod) MarshalJSON() ([]byte, error) {
+	type method OpenRPCMethod
+	b, err := json.Marshal(method(m))
+	if err != nil || len(m.Extensions) == 0 {
+		return b, err
+	}
+	var out map[string]interface{}
+	if err = json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	for k, v := range m.Extensions {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
+
+// OpenRPCContent 参数或结果描述
+type OpenRPCContent struct {
+	Name     string      `json:"name"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+// OpenRPCComponents 可复用的结构定义
+type OpenRPCComponents struct {
+	Schemas map[string]*JSONSchema `json:"schemas,omitempty"`
+}
+
+// JSONSchema 参数与结果结构使用的 json schema 子集
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// Discover 根据已注册的服务生成 OpenRPC 文档
+func (svr *Server) Discover() *OpenRPC {
+	g := &schemaGenerator{schemas: make(map[string]*JSONSchema), names: make(map[reflect.Type]string)}
+	doc := &OpenRPC{
+		OpenRPC: OpenRPCVersion,
+		Info:    svr.Info,
+		Methods: make([]OpenRPCMethod, 0),
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = "goframe-jsonrpc"
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "1.0.0"
+	}
+
+	// 按方法名排序后生成，同名类型的 components 名称保持稳定
+	methods := make(map[string]*Method)
+	names := make([]string, 0)
+	svr.Sm.Range(func(_, v interface{}) bool {
+		svc := v.(*Service)
+		for _, m := range svc.Mm {
+			name := svr.Naming.Join(svc.Name, m.Name)
+			methods[name] = m
+			names = append(names, name)
+		}
+		return true
+	})
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Methods = append(doc.Methods, g.method(name, methods[name]))
+	}
+	if len(g.schemas) > 0 {
+		doc.Components = &OpenRPCComponents{Schemas: g.schemas}
+	}
+	return doc
+}
+
+// schemaGenerator 通过反射生成 json schema，具名结构体放入 components 中复用
+type schemaGenerator struct {
+	schemas map[string]*JSONSchema
+	names   map[reflect.Type]string // 类型在 components 中的名称，不同包的同名类型使用不同名称
+}
+
+func (g *schemaGenerator) method(name string, m *Method) OpenRPCMethod {
+	om := OpenRPCMethod{Name: name, Params: make([]OpenRPCContent, 0)}
+	pt := indirectType(m.ParamsType)
+	if pt.Kind() == reflect.Struct {
+		// 结构体参数按字段展开为具名参数
+		om.ParamStructure = "by-name"
+		for _, f := range structFields(pt) {
+			om.Params = append(om.Params, OpenRPCContent{
+				Name:     f.name,
+				Required: f.required,
+				Schema:   g.schema(f.typ),
+			})
+		}
+	} else {
+		om.Params = append(om.Params, OpenRPCContent{Name: "params", Required: true, Schema: g.schema(pt)})
+	}
+
+	if m.Stream {
+		// 流式方法的最终响应固定为 StreamEnd，分片通过 rpc.stream 通知推送
+		om.Result = OpenRPCContent{Name: "result", Schema: g.schema(reflect.TypeOf(StreamEnd{}))}
+		om.Extensions = map[string]interface{}{"x-stream": true, "x-stream-notification": StreamMethod}
+	} else {
+		om.Result = OpenRPCContent{Name: "result", Schema: g.schema(indirectType(m.ResultType))}
+	}
+	return om
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) *JSONSchema {
+	t = indirectType(t)
+	if t == rawMessageType {
+		// 原样输出的 json，可以是任意值
+		return &JSONSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string", Format: "byte"}
+		}
+		return &JSONSchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return &JSONSchema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.componentName(t)
+			g.names[t] = name
+			g.schemas[name] = nil // 先占位，避免递归结构无限展开
+			g.schemas[name] = g.object(t)
+		}
+		return &JSONSchema{Ref: "#/components/schemas/" + name}
+	default:
+		// interface{} 等无法确定的类型允许任意值
+		return &JSONSchema{}
+	}
+}
+
+// componentName 返回类型在 components 中未被占用的名称
+// 与其它包的同名类型冲突时加上包名前缀，仍然冲突时追加序号
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	name := schemaName(t.Name())
+	if _, taken := g.schemas[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	base := schemaName(pkg) + "." + name
+	name = base
+	for i := 2; ; i++ {
+		if _, taken := g.schemas[name]; !taken {
+			return name
+		}
+		name = base + "_" + strconv.Itoa(i)
+	}
+}
+
+// schemaName 将类型名转换为 components 允许的名称，只保留字母、数字与 . - _
+// 泛型的类型参数去掉包路径，Page[github.com/a/pkg.Item] 转换为 Page_pkg.Item
+func schemaName(name string) string {
+	b := make([]byte, 0, len(name))
+	start := 0
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '/':
+			b = b[:start]
+		case c == '[' || c == ']' || c == ',':
+			b = append(b, '_')
+			start = len(b)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+			b = append(b, c)
+		default:
+			b = append(b, '_')
+		}
+	}
+	return strings.TrimRight(string(b), "_")
+}
+
+func (g *schemaGenerator) object(t reflect.Type) *JSONSchema {
+	s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+	for _, f := range structFields(t) {
+		s.Properties[f.name] = g.schema(f.typ)
+		if f.required {
+			s.Required = append(s.Required, f.name)
+		}
+	}
+	return s
+}
+
+// field 结构体字段在 json 中的表现
+type field struct {
+	name     string
+	index    []int
+	typ      reflect.Type
+	required bool
+}
+
+// structFields 按 json 标签解析结构体的导出字段，匿名嵌入的结构体字段会被展开
+// 未声明 omitempty 且不是指针的字段视为必填
+func structFields(t reflect.Type) []field {
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("json")
+		if sf.Anonymous && !hasTag && indirectType(sf.Type).Kind() == reflect.Struct {
+			if sf.Type.Kind() == reflect.Ptr {
+				// 嵌入的结构体指针无法直接赋值，跳过
+				continue
+			}
+			for _, f := range structFields(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		omitEmpty := false
+		if hasTag {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, o := range parts[1:] {
+				if o == "omitempty" {
+					omitEmpty = true
+				}
+			}
+		}
+		fields = append(fields, field{
+			name:     name,
+			index:    []int{i},
+			typ:      sf.Type,
+			required: !omitEmpty && sf.Type.Kind() != reflect.Ptr,
+		})
+	}
+	return fields
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type discoverItem struct {
+	Id int `json:"id"`
+}
+
+type discoverPage[T any] struct {
+	Items []T `json:"items"`
+}
+
+type discoverArgs struct {
+	Item  discoverItem    `json:"item"`
+	Extra json.RawMessage `json:"extra,omitempty"`
+}
+
+type discoverResult struct {
+	Page  discoverPage[discoverItem] `json:"page"`
+	Other interface{}                `json:"other"`
+}
+
+type discoverService struct{}
+
+func (discoverService) List(args *discoverArgs, result *discoverResult) error {
+	return nil
+}
+
+func TestDiscoverComponentNames(t *testing.T) {
+	// 与 discoverItem 同名的局部类型
+	type discoverItem struct {
+		Name string `json:"name"`
+	}
+	type otherArgs struct {
+		Item discoverItem `json:"item"`
+	}
+	svr := &Server{}
+	if err := svr.RegisterName("list", discoverService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.RegisterFunc("other.get", func(args *otherArgs, result *int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := svr.Discover()
+	if doc.Components == nil {
+		t.Fatal("no components")
+	}
+	schemas := doc.Components.Schemas
+	for _, name := range []string{"discoverItem", "common.discoverItem", "discoverPage_common.discoverItem", "discoverResult"} {
+		if schemas[name] == nil {
+			t.Errorf("missing component %s in %v", name, keys(schemas))
+		}
+	}
+	if len(schemas) != 4 {
+		t.Errorf("components %v", keys(schemas))
+	}
+	if _, ok := schemas["discoverItem"].Properties["id"]; !ok {
+		t.Errorf("discoverItem = %+v, want the first registered type", schemas["discoverItem"])
+	}
+	if _, ok := schemas["common.discoverItem"].Properties["name"]; !ok {
+		t.Errorf("common.discoverItem = %+v, want the local type", schemas["common.discoverItem"])
+	}
+
+	// json.RawMessage 可以是任意值
+	var extra *JSONSchema
+	for _, m := range doc.Methods {
+		for _, p := range m.Params {
+			if m.Name == "list.List" && p.Name == "extra" {
+				extra = p.Schema
+			}
+		}
+	}
+	if extra == nil || extra.Type != "" || extra.Format != "" {
+		t.Errorf("extra schema %+v, want any value", extra)
+	}
+}
+
+func keys(m map[string]*JSONSchema) []string {
+	list := make([]string, 0, len(m))
+	for k := range m {
+		list = append(list, k)
+	}
+	return list
+}
+
+func TestSchemaName(t *testing.T) {
+	for name, want := range map[string]string{
+		"User":                                 "User",
+		"Page[github.com/a/pkg.Item]":          "Page_pkg.Item",
+		"Pair[string,*github.com/a/b.Item]":    "Pair_string_b.Item",
+		"Map[github.com/a/b.K,map[string]int]": "Map_b.K_map_string_int",
+	} {
+		if got := schemaName(name); got != want {
+			t.Errorf("schemaName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Peer 当前请求的调用方信息，由传输层放入上下文
+type Peer struct {
+	Transport  string      // 传输协议 http 或 tcp
+	RemoteAddr string      // 调用方地址 ip:port
+	Header     http.Header // http 请求头，tcp 协议为 nil
+	Principal  *Principal  // 连接级别认证后的调用方身份，如 http 请求头或 tcp 认证握手
+	authErr    error       // 连接级别认证失败的原因
+
+	mu         sync.Mutex
+	handled    int           // 已处理的请求数，批量请求中每个元素计数一次
+	rejected   int           // 因限流或过载被拒绝的请求数
+	code       int           // 第一个被拒绝的请求的错误码
+	retryAfter time.Duration // 被拒绝请求中最长的等待时间
+}
+
+type peerKey struct{}
+
+// WithPeer 将调用方信息放入上下文
+func WithPeer(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// PeerFromContext 获取上下文中的调用方信息，未设置时返回 nil
+func PeerFromContext(ctx context.Context) *Peer {
+	p, _ := ctx.Value(peerKey{}).(*Peer)
+	return p
+}
+
+// IP 返回调用方地址中的 ip
+func (p *Peer) IP() string {
+	host, _, err := net.SplitHostPort(p.RemoteAddr)
+	if err != nil {
+		return p.RemoteAddr
+	}
+	return host
+}
+
+// Rejected 本次处理的请求全部因限流或过载被拒绝时返回错误码与建议的等待时间，否则错误码为 0
+// http 协议据此返回 429 或 503
+func (p *Peer) Rejected() (int, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handled == 0 || p.rejected < p.handled {
+		return 0, 0
+	}
+	return p.code, p.retryAfter
+}
+
+// Reset 清空请求计数，tcp 连接在处理每条消息前调用
+func (p *Peer) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handled, p.rejected, p.code, p.retryAfter = 0, 0, 0, 0
+}
+
+func (p *Peer) handle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handled++
+}
+
+func (p *Peer) reject(code int, retryAfter time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rejected++
+	if p.code == 0 {
+		p.code = code
+	}
+	if retryAfter > p.retryAfter {
+		p.retryAfter = retryAfter
+	}
+}
@@ -0,0 +1,190 @@
+package common
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitKey 返回请求所属的限流分组，相同分组共享一个令牌桶，返回空字符串时该规则不限制此请求
+// service 与 method 为注册时的服务名与方法名，方法不存在时为空
+type RateLimitKey func(ctx context.Context, service string, method string) string
+
+// 内置的限流分组
+var (
+	// LimitGlobal 所有请求共享一个令牌桶
+	LimitGlobal RateLimitKey = func(ctx context.Context, service string, method string) string {
+		return "*"
+	}
+	// LimitByIP 按调用方 ip 分组
+	LimitByIP RateLimitKey = func(ctx context.Context, service string, method string) string {
+		if p := PeerFromContext(ctx); p != nil {
+			return p.IP()
+		}
+		return ""
+	}
+	// LimitByIdentity 按认证后的调用方身份分组，未认证的请求不受限制
+	LimitByIdentity RateLimitKey = func(ctx context.Context, service string, method string) string {
+		if p := PrincipalFromContext(ctx); p != nil {
+			return p.Id
+		}
+		return ""
+	}
+	// LimitByService 按服务分组
+	LimitByService RateLimitKey = func(ctx context.Context, service string, method string) string {
+		return service
+	}
+	// LimitByMethod 按方法分组，别名与不同命名风格的调用共享令牌桶
+	LimitByMethod RateLimitKey = func(ctx context.Context, service string, method string) string {
+		if method == "" {
+			return ""
+		}
+		return service + "." + method
+	}
+)
+
+// RateLimit 限流规则，按 Key 分组后每个分组使用独立的令牌桶
+//
+//	s.AddRateLimit(common.RateLimit{Key: common.LimitByIP, Limit: 100, Burst: 200})
+//	s.AddRateLimit(common.RateLimit{Key: common.LimitByMethod, Limit: 1, Burst: 2, Methods: []string{"report/export"}})
+type RateLimit struct {
+	Key     RateLimitKey  // 分组方式
+	Limit   rate.Limit    // 每秒生成的令牌数
+	Burst   int           // 令牌桶容量
+	Methods []string      // 只限制这些服务或方法，为空时限制所有请求，方法名支持别名与各种命名风格
+	Idle    time.Duration // 分组空闲超过该时间后回收令牌桶，默认 10 分钟
+}
+
+// RateLimitData 限流错误的 data，retryAfter 为建议的等待秒数
+type RateLimitData struct {
+	RetryAfter float64 `json:"retryAfter"`
+}
+
+// rateLimiter 一条限流规则及其所有分组的令牌桶
+type rateLimiter struct {
+	rule      RateLimit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	used    time.Time
+}
+
+func newRateLimiter(rule RateLimit) *rateLimiter {
+	if rule.Idle <= 0 {
+		rule.Idle = 10 * time.Minute
+	}
+	return &rateLimiter{rule: rule, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// reserve 在分组的令牌桶中预留一个令牌，由调用方决定保留或取消
+func (l *rateLimiter) reserve(key string, now time.Time) *rate.Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// 定期回收空闲的分组，避免按 ip 等分组时令牌桶无限增长
+	if now.Sub(l.lastSweep) > l.rule.Idle {
+		for k, b := range l.buckets {
+			if now.Sub(b.used) > l.rule.Idle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.rule.Limit, l.rule.Burst)}
+		l.buckets[key] = b
+	}
+	b.used = now
+	return b.limiter.ReserveN(now, 1)
+}
+
+// AddRateLimit 添加一条限流规则，请求需要通过所有规则才会执行
+func (svr *Server) AddRateLimit(rule RateLimit) {
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	old, _ := svr.rateLimiters.Load().([]*rateLimiter)
+	limiters := make([]*rateLimiter, len(old), len(old)+1)
+	copy(limiters, old)
+	svr.rateLimiters.Store(append(limiters, newRateLimiter(rule)))
+}
+
+// rateLimit 检查全局限流器与所有限流规则，返回是否允许执行以及建议的等待时间
+// 先在所有适用的令牌桶中预留令牌，任意一个不允许时全部取消，被拒绝的请求不消耗其它令牌桶的令牌
+func (svr *Server) rateLimit(ctx context.Context, svc *Service, m *Method) (bool, time.Duration) {
+	now := time.Now()
+	var (
+		reservations []*rate.Reservation
+		allowed      = true
+		wait         time.Duration
+	)
+	check := func(r *rate.Reservation) {
+		reservations = append(reservations, r)
+		if !r.OK() {
+			allowed = false
+		} else if delay := r.DelayFrom(now); delay > 0 {
+			allowed = false
+			if delay > wait {
+				wait = delay
+			}
+		}
+	}
+	if svr.RateLimiter != nil {
+		check(svr.RateLimiter.ReserveN(now, 1))
+	}
+	limiters, _ := svr.rateLimiters.Load().([]*rateLimiter)
+	var service, method string
+	if svc != nil && m != nil {
+		service, method = svc.Name, m.Name
+	}
+	for _, l := range limiters {
+		if !svr.matchMethods(l.rule.Methods, service, method) {
+			continue
+		}
+		key := l.rule.Key(ctx, service, method)
+		if key == "" {
+			continue
+		}
+		check(l.reserve(key, now))
+	}
+	if !allowed {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		return false, wait
+	}
+	return true, 0
+}
+
+// matchMethods 检测方法是否在规则的限制范围内，列表中可以是服务名或方法名
+func (svr *Server) matchMethods(list []string, service string, method string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	if service == "" {
+		return false
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, service) {
+			return true
+		}
+		if svc, m, ok := svr.Lookup(v); ok && svc.Name == service && m.Name == method {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimited 返回限流错误响应
+func rateLimited(id interface{}, jsonRpc string, delay time.Duration) interface{} {
+	// 保留毫秒精度
+	retryAfter := math.Ceil(delay.Seconds()*1000) / 1000
+	return ED(id, jsonRpc, RateLimited, RateLimitData{RetryAfter: retryAfter})
+}
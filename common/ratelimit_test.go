@@ -0,0 +1,147 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	l := newRateLimiter(RateLimit{Key: LimitGlobal, Limit: 2, Burst: 1})
+	now := time.Now()
+	if ok, _ := take(l, "*", now); !ok {
+		t.Fatal("first request limited")
+	}
+	ok, delay := take(l, "*", now)
+	if ok {
+		t.Fatal("request over burst allowed")
+	}
+	// 每秒 2 个令牌，等待 500ms
+	if delay < 450*time.Millisecond || delay > 500*time.Millisecond {
+		t.Errorf("retry after %s, want ~500ms", delay)
+	}
+	// 被拒绝的请求不消耗令牌，等待建议的时间后可以通过
+	if ok, _ := take(l, "*", now.Add(delay)); !ok {
+		t.Errorf("request after %s still limited", delay)
+	}
+}
+
+func TestRateLimiterKeysAndSweep(t *testing.T) {
+	l := newRateLimiter(RateLimit{Key: LimitByIP, Limit: 1, Burst: 1, Idle: time.Minute})
+	now := time.Now()
+	if ok, _ := take(l, "10.0.0.1", now); !ok {
+		t.Fatal("10.0.0.1 limited")
+	}
+	if ok, _ := take(l, "10.0.0.2", now); !ok {
+		t.Fatal("分组之间不应共享令牌桶")
+	}
+	if ok, _ := take(l, "10.0.0.1", now); ok {
+		t.Fatal("10.0.0.1 allowed over burst")
+	}
+	// 空闲超过 Idle 的分组被回收
+	take(l, "10.0.0.3", now.Add(2*time.Minute))
+	if _, ok := l.buckets["10.0.0.1"]; ok {
+		t.Error("idle bucket not swept")
+	}
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets = %d, want 1", len(l.buckets))
+	}
+}
+
+func TestRateLimitResponse(t *testing.T) {
+	svr := newBenchServer(t)
+	svr.AddRateLimit(RateLimit{Key: LimitByMethod, Limit: 0.5, Burst: 1, Methods: []string{"arith.add"}})
+	req := []byte(`{"jsonrpc":"2.0","id":"1","method":"arith.add","params":{"a":1,"b":2}}`)
+	ctx := context.Background()
+	if res := svr.HandlerContext(ctx, req); !json.Valid(res) || responseCode(t, res) != WithoutError {
+		t.Fatalf("first request: %s", res)
+	}
+	res := svr.HandlerContext(ctx, req)
+	var r struct {
+		Error struct {
+			Code int           `json:"code"`
+			Data RateLimitData `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(res, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Error.Code != RateLimited {
+		t.Fatalf("code = %d, want %d: %s", r.Error.Code, RateLimited, res)
+	}
+	if r.Error.Data.RetryAfter <= 1.9 || r.Error.Data.RetryAfter > 2 {
+		t.Errorf("retryAfter = %v, want ~2", r.Error.Data.RetryAfter)
+	}
+	// 规则只限制 arith.add，其它方法不受影响
+	other := []byte(`{"jsonrpc":"2.0","id":"2","method":"arith.nope"}`)
+	if code := responseCode(t, svr.HandlerContext(ctx, other)); code != MethodNotFound {
+		t.Errorf("unrelated method code = %d, want %d", code, MethodNotFound)
+	}
+}
+
+// 后面的规则拒绝请求时，全局限流器与前面规则预留的令牌全部退回
+func TestRateLimitRejectionKeepsOtherTokens(t *testing.T) {
+	svr := newBenchServer(t)
+	if err := svr.RegisterName("calc", helperService{}); err != nil {
+		t.Fatal(err)
+	}
+	svr.RateLimiter = rate.NewLimiter(0.001, 2)
+	svr.AddRateLimit(RateLimit{Key: LimitByService, Limit: 0.001, Burst: 2})
+	svr.AddRateLimit(RateLimit{Key: LimitByMethod, Limit: 0.001, Burst: 1, Methods: []string{"arith.add"}})
+	ctx := context.Background()
+	add := []byte(`{"jsonrpc":"2.0","id":"1","method":"arith.add","params":{"a":1,"b":2}}`)
+	calc := []byte(`{"jsonrpc":"2.0","id":"2","method":"calc.add","params":{"a":1,"b":2}}`)
+
+	if code := responseCode(t, svr.HandlerContext(ctx, add)); code != WithoutError {
+		t.Fatalf("first arith.add code = %d", code)
+	}
+	for i := 0; i < 3; i++ {
+		if code := responseCode(t, svr.HandlerContext(ctx, add)); code != RateLimited {
+			t.Fatalf("arith.add over method limit code = %d, want %d", code, RateLimited)
+		}
+	}
+	// 全局令牌桶还剩一个令牌
+	if code := responseCode(t, svr.HandlerContext(ctx, calc)); code != WithoutError {
+		t.Fatalf("calc.add code = %d, rejected calls drained the global limiter", code)
+	}
+	if code := responseCode(t, svr.HandlerContext(ctx, calc)); code != RateLimited {
+		t.Errorf("calc.add over global limit code = %d, want %d", code, RateLimited)
+	}
+	// arith 服务的令牌桶没有被拒绝的请求消耗
+	svr.RateLimiter = nil
+	l := svr.rateLimiters.Load().([]*rateLimiter)[0]
+	if ok, _ := take(l, "arith", time.Now()); !ok {
+		t.Error("rejected calls drained the service limiter")
+	}
+}
+
+// take 预留并保留一个令牌，令牌不足时取消预留并返回需要等待的时间
+func take(l *rateLimiter, key string, now time.Time) (bool, time.Duration) {
+	r := l.reserve(key, now)
+	if !r.OK() {
+		return false, 0
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// responseCode 返回响应的错误码，成功响应返回 WithoutError
+func responseCode(t *testing.T, res []byte) int {
+	t.Helper()
+	var r struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.Unmarshal(res, &r); err != nil {
+		t.Fatalf("%s: %v", res, err)
+	}
+	if r.Error == nil {
+		return WithoutError
+	}
+	return r.Error.Code
+}
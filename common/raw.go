@@ -0,0 +1,228 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// RawRequest 保留原始 params 的请求，参数在确定目标类型后再解析
+type RawRequest struct {
+	Id      interface{}     // 请求 id，字符串 id 去掉引号，数字 id 为字面量，通知请求为 nil
+	RawId   json.RawMessage // 请求 id 的原始数据，响应中原样返回，通知请求为 nil
+	JsonRpc string          // 协议版本号
+	Method  string          // 请求方法
+	Params  json.RawMessage // 原始参数，Codec 不是 json 时为该编码的原始数据
+	Auth    string          // 请求携带的认证信息，格式与 Authorization 请求头一致
+	Sign    *Signature      // 请求签名
+	Trace   TraceCarrier    // 请求携带的 trace context
+	Codec   RawCodec        // 请求的编码，为 nil 时为 json
+
+	id interface{} // json 以外编码的请求 id，响应中原样返回
+}
+
+// RawResponse 保留原始 result 的响应
+type RawResponse struct {
+	Id     interface{}     `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// SplitBatch 拆分请求体或响应体，批量请求返回每个元素的原始数据
+func SplitBatch(b []byte) (list []json.RawMessage, batch bool, err error) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &list)
+		return list, true, err
+	}
+	if !json.Valid(b) {
+		return nil, false, errors.New("rpc: 无效的 json 数据")
+	}
+	return []json.RawMessage{b}, false, nil
+}
+
+// envelope 请求的协议字段，params 与 id 保持原始数据
+type envelope struct {
+	Id      json.RawMessage `json:"id"`
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Auth    string          `json:"auth"`
+	Sign    *Signature      `json:"sign"`
+	Trace   TraceCarrier    `json:"trace"`
+}
+
+// ParseRawRequest 解析单个请求，只解析协议字段，params 保持原样
+func ParseRawRequest(b json.RawMessage) (req *RawRequest, errCode int) {
+	req = &RawRequest{}
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		Debug(err)
+		return req, InvalidRequest
+	}
+	if env.Id != nil {
+		req.RawId = env.Id
+		// 字符串 id 去掉引号，数字 id 直接使用字面量
+		if env.Id[0] == '"' {
+			var id string
+			if err := json.Unmarshal(env.Id, &id); err != nil {
+				return req, InvalidRequest
+			}
+			req.Id = id
+		} else if isNull(env.Id) {
+			req.Id = ""
+		} else if c := env.Id[0]; c == '-' || (c >= '0' && c <= '9') {
+			req.Id = string(env.Id)
+		} else {
+			// id 只能是字符串、数字或 null，无法确定时响应的 id 为 null
+			req.RawId = json.RawMessage("null")
+			req.Id = ""
+			return req, InvalidRequest
+		}
+	}
+	req.JsonRpc, req.Method, req.Auth, req.Sign, req.Trace = env.JsonRpc, env.Method, env.Auth, env.Sign, env.Trace
+	if req.Method == "" {
+		return req, InvalidRequest
+	}
+	if !isNull(env.Params) {
+		req.Params = env.Params
+	}
+	return req, WithoutError
+}
+
+// nullId 请求的 id 为 null 时响应的 id，与通知请求的 nil 区分
+var nullId *string
+
+// parseCodecRequest 按 json 以外的编码解析单个请求，params 保持该编码的原始数据
+func parseCodecRequest(c RawCodec, b []byte) (req *RawRequest, errCode int) {
+	req = &RawRequest{Codec: c}
+	fields, err := c.UnmarshalObject(b)
+	if err != nil {
+		Debug(err)
+		return req, InvalidRequest
+	}
+	if raw, ok := fields["id"]; ok {
+		var id interface{}
+		if err = c.Unmarshal(raw, &id); err != nil {
+			return req, InvalidRequest
+		}
+		switch v := id.(type) {
+		case nil:
+			req.Id, req.id = "", nullId
+		case string:
+			req.Id, req.id = v, v
+		case int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64:
+			// 数字 id 与 json 一样使用字面量
+			req.Id, req.id = string(fromCodec(v).(json.Number)), v
+		default:
+			req.Id, req.id = "", nullId
+			return req, InvalidRequest
+		}
+	}
+	for name, v := range map[string]interface{}{"jsonrpc": &req.JsonRpc, "method": &req.Method, "auth": &req.Auth, "sign": &req.Sign, "trace": &req.Trace} {
+		if raw, ok := fields[name]; ok {
+			if err = c.Unmarshal(raw, v); err != nil {
+				return req, InvalidRequest
+			}
+		}
+	}
+	if req.Method == "" {
+		return req, InvalidRequest
+	}
+	if raw := fields["params"]; !isCodecNull(c, raw) {
+		req.Params = raw
+	}
+	return req, WithoutError
+}
+
+// responseId 响应中的 id，与请求的 id 完全一致，通知请求返回 nil
+func (r *RawRequest) responseId() interface{} {
+	if r.Codec != nil && !IsJSON(r.Codec) {
+		return r.id
+	}
+	if r.RawId == nil {
+		return nil
+	}
+	return r.RawId
+}
+
+// decodeParams 将 params 解析到 pv 中，json 以外的编码直接由该编码解析
+func (r *RawRequest) decodeParams(pv interface{}, strict bool) error {
+	if r.Codec == nil {
+		return DecodeRaw(r.Params, pv, strict)
+	}
+	return decodeValue(r.Codec, r.Params, pv, strict)
+}
+
+// jsonParams 返回 json 格式的 params，用于签名校验与访问日志
+func (r *RawRequest) jsonParams() (json.RawMessage, error) {
+	if r.Codec == nil || IsJSON(r.Codec) || len(r.Params) == 0 {
+		return r.Params, nil
+	}
+	return ToJSON(r.Codec, r.Params)
+}
+
+func isNull(b json.RawMessage) bool {
+	return len(b) == 0 || string(b) == "null"
+}
+
+// isCodecNull 检测原始数据是否为空值，空值在各编码中都只占一个字节
+func isCodecNull(c RawCodec, b []byte) bool {
+	if len(b) != 1 {
+		return len(b) == 0
+	}
+	var v interface{}
+	return c.Unmarshal(b, &v) == nil && v == nil
+}
+
+// DecodeRaw 将原始数据解析到 pv 中，目标为 json.RawMessage 时直接复制原始数据
+// 宽松模式下先由 encoding/json 直接解析到目标类型，失败时再通过 BindParams 转换类型并给出每个字段的错误
+func DecodeRaw(raw json.RawMessage, pv interface{}, strict bool) error {
+	if rm, ok := pv.(*json.RawMessage); ok {
+		*rm = append((*rm)[:0], raw...)
+		return nil
+	}
+	rv := reflect.ValueOf(pv).Elem()
+	// 按位置传递的结构体参数只能由 BindParams 处理
+	positional := len(raw) > 0 && raw[0] == '[' && rv.Kind() == reflect.Struct
+	if !strict && len(raw) > 0 && !positional {
+		if err := json.Unmarshal(raw, pv); err == nil {
+			return nil
+		}
+		// 解析失败时目标可能已被部分赋值，重置后再绑定
+		rv.Set(reflect.Zero(rv.Type()))
+	}
+	var data interface{}
+	if len(raw) > 0 {
+		// 保留数字的原始文本，超过 2^53 的整数不经过 float64
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return err
+		}
+	}
+	return BindParams(data, pv, strict)
+}
+
+// getRawResponse 解析单一请求的响应，结果类型为 json.RawMessage 时保留原始数据，不做二次转换
+func getRawResponse(b json.RawMessage, result interface{}) error {
+	var res RawResponse
+	if err := json.Unmarshal(b, &res); err != nil {
+		Debug(err)
+		return err
+	}
+	if res.Error != nil {
+		Debug(res.Error.Message)
+		return res.Error
+	}
+	// 处理返回结果值
+	if result == nil {
+		return nil
+	}
+	if err := DecodeRaw(res.Result, result, false); err != nil {
+		Debug(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type benchArith struct{}
+
+type benchArgs struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func (benchArith) Add(args *benchArgs, result *int) error {
+	*result = args.A + args.B
+	return nil
+}
+
+func newBenchServer(tb testing.TB) *Server {
+	svr := &Server{}
+	if err := svr.RegisterName("arith", benchArith{}); err != nil {
+		tb.Fatal(err)
+	}
+	return svr
+}
+
+func TestHandlerEchoesRequestId(t *testing.T) {
+	svr := newBenchServer(t)
+	cases := map[string]string{
+		`{"jsonrpc":"2.0","id":5,"method":"arith.add","params":{"a":1,"b":2}}`:                `5`,
+		`{"jsonrpc":"2.0","id":9007199254740993,"method":"arith.add","params":{"a":1,"b":2}}`: `9007199254740993`,
+		`{"jsonrpc":"2.0","id":"5","method":"arith.add","params":{"a":1,"b":2}}`:              `"5"`,
+		`{"jsonrpc":"2.0","id":null,"method":"arith.add","params":{"a":1,"b":2}}`:             `null`,
+		`{"jsonrpc":"2.0","id":1.5,"method":"arith.nope"}`:                                    `1.5`,
+		`[{"jsonrpc":"2.0","id":7,"method":"arith.add","params":[1,2]}]`:                      `7`,
+		`{"jsonrpc":"2.0","id":"ab","method":"arith.add","params":{"a":1,"b":2}}`:             `"ab"`,
+		`{"jsonrpc":"2.0","id":{"bad":true},"method":"arith.add","params":{"a":1,"b":2}}`:     `null`,
+	}
+	for req, want := range cases {
+		res := svr.HandlerContext(context.Background(), []byte(req))
+		var list []struct {
+			Id json.RawMessage `json:"id"`
+		}
+		if strings.HasPrefix(string(res), "[") {
+			if err := json.Unmarshal(res, &list); err != nil {
+				t.Fatalf("%s: %v", res, err)
+			}
+		} else {
+			list = make([]struct {
+				Id json.RawMessage `json:"id"`
+			}, 1)
+			if err := json.Unmarshal(res, &list[0]); err != nil {
+				t.Fatalf("%s: %v", res, err)
+			}
+		}
+		if got := string(list[0].Id); got != want {
+			t.Errorf("%s: response id %s, want %s", req, got, want)
+		}
+	}
+}
+
+func BenchmarkHandler(b *testing.B) {
+	svr := newBenchServer(b)
+	single := []byte(`{"jsonrpc":"2.0","id":"1","method":"arith.add","params":{"a":1,"b":2}}`)
+	elems := make([]string, 10)
+	for i := range elems {
+		elems[i] = `{"jsonrpc":"2.0","id":"1","method":"arith.add","params":[1,2]}`
+	}
+	batch := []byte("[" + strings.Join(elems, ",") + "]")
+	ctx := context.Background()
+
+	b.Run("single", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(single)))
+		for i := 0; i < b.N; i++ {
+			svr.HandlerContext(ctx, single)
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(batch)))
+		for i := 0; i < b.N; i++ {
+			svr.HandlerContext(ctx, batch)
+		}
+	})
+}
+
+// BenchmarkDecodeParams 对比按目标类型直接解析原始参数与先解析为 map 再绑定的方式
+func BenchmarkDecodeParams(b *testing.B) {
+	raw := json.RawMessage(`{"a":1,"b":2}`)
+	b.Run("raw", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var args benchArgs
+			if err := DecodeRaw(raw, &args, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var data map[string]interface{}
+			if err := json.Unmarshal(raw, &data); err != nil {
+				b.Fatal(err)
+			}
+			var args benchArgs
+			if err := BindParams(data, &args, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets 耗时直方图的默认分桶，单位为秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry 默认的指标注册表
+var DefaultRegistry = NewRegistry()
+
+// Registry 指标注册表，以 Prometheus 文本格式输出
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metricVec
+	byName  map[string]*metricVec
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*metricVec)}
+}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// metricVec 同名指标按标签值区分的所有序列
+type metricVec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  sync.Map // 标签值 => *series
+}
+
+type series struct {
+	values []string
+	value  uint64   // float64 的二进制表示，计数器与仪表盘使用
+	counts []uint64 // 直方图每个分桶的计数，不累加
+	sum    uint64
+	count  uint64
+}
+
+// register 注册指标，同名指标已存在时返回已注册的指标，类型、标签或分桶不一致时返回错误
+func (r *Registry) register(name, help, kind string, buckets []float64, labels []string) (*metricVec, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.byName[name]; ok {
+		if v.kind != kind || strings.Join(v.labels, ",") != strings.Join(labels, ",") || fmt.Sprint(v.buckets) != fmt.Sprint(buckets) {
+			return nil, fmt.Errorf("rpc: 指标 %s 已注册为其它类型或标签", name)
+		}
+		return v, nil
+	}
+	v := &metricVec{name: name, help: help, kind: kind, labels: labels, buckets: buckets}
+	r.metrics = append(r.metrics, v)
+	r.byName[name] = v
+	return v, nil
+}
+
+// with 返回标签值对应的序列，标签值的数量不一致时记录日志并返回 nil，调用方忽略本次记录
+func (v *metricVec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		Debug(fmt.Sprintf("rpc: 指标 %s 需要 %d 个标签值", v.name, len(v.labels)))
+		return nil
+	}
+	key := strings.Join(values, "\xff")
+	if s, ok := v.series.Load(key); ok {
+		return s.(*series)
+	}
+	s := &series{values: append([]string(nil), values...)}
+	if v.kind == kindHistogram {
+		s.counts = make([]uint64, len(v.buckets)+1)
+	}
+	actual, _ := v.series.LoadOrStore(key, s)
+	return actual.(*series)
+}
+
+func addFloat(p *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(p)
+		if atomic.CompareAndSwapUint64(p, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// CounterVec 计数器
+type CounterVec struct{ v *metricVec }
+
+// Counter 注册计数器，同名指标已注册为其它类型或标签时返回错误
+func (r *Registry) Counter(name string, help string, labels ...string) (*CounterVec, error) {
+	v, err := r.register(name, help, kindCounter, nil, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &CounterVec{v}, nil
+}
+
+// Inc 按标签值加一
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add 按标签值增加，delta 不能为负数
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if s := c.v.with(values); s != nil {
+		addFloat(&s.value, delta)
+	}
+}
+
+// GaugeVec 仪表盘
+type GaugeVec struct{ v *metricVec }
+
+// Gauge 注册仪表盘，同名指标已注册为其它类型或标签时返回错误
+func (r *Registry) Gauge(name string, help string, labels ...string) (*GaugeVec, error) {
+	v, err := r.register(name, help, kindGauge, nil, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &GaugeVec{v}, nil
+}
+
+// Add 按标签值增加，可以为负数
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	if s := g.v.with(values); s != nil {
+		addFloat(&s.value, delta)
+	}
+}
+
+// Set 按标签值设置
+func (g *GaugeVec) Set(value float64, values ...string) {
+	if s := g.v.with(values); s != nil {
+		atomic.StoreUint64(&s.value, math.Float64bits(value))
+	}
+}
+
+// HistogramVec 直方图
+type HistogramVec struct{ v *metricVec }
+
+// Histogram 注册直方图，buckets 为升序的分桶上限，为空时使用 DefaultBuckets，同名指标已注册为其它类型、标签或分桶时返回错误
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) (*HistogramVec, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	v, err := r.register(name, help, kindHistogram, buckets, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &HistogramVec{v}, nil
+}
+
+// Observe 按标签值记录一个观测值
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	s := h.v.with(values)
+	if s == nil {
+		return
+	}
+	i := sort.SearchFloat64s(h.v.buckets, value)
+	atomic.AddUint64(&s.counts[i], 1)
+	addFloat(&s.sum, value)
+	atomic.AddUint64(&s.count, 1)
+}
+
+// WriteTo 以 Prometheus 文本格式输出所有指标
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]*metricVec(nil), r.metrics...)
+	r.mu.Unlock()
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	for _, v := range metrics {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+		list := make([]*series, 0)
+		v.series.Range(func(_, s interface{}) bool {
+			list = append(list, s.(*series))
+			return true
+		})
+		sort.Slice(list, func(i, j int) bool {
+			return strings.Join(list[i].values, "\xff") < strings.Join(list[j].values, "\xff")
+		})
+		for _, s := range list {
+			labels := formatLabels(v.labels, s.values)
+			if v.kind != kindHistogram {
+				fmt.Fprintf(cw, "%s%s %s\n", v.name, wrapLabels(labels), formatFloat(math.Float64frombits(atomic.LoadUint64(&s.value))))
+				continue
+			}
+			var cumulative uint64
+			for i, le := range v.buckets {
+				cumulative += atomic.LoadUint64(&s.counts[i])
+				fmt.Fprintf(cw, "%s_bucket%s %d\n", v.name, wrapLabels(labels, `le="`+formatFloat(le)+`"`), cumulative)
+			}
+			cumulative += atomic.LoadUint64(&s.counts[len(v.buckets)])
+			fmt.Fprintf(cw, "%s_bucket%s %d\n", v.name, wrapLabels(labels, `le="+Inf"`), cumulative)
+			fmt.Fprintf(cw, "%s_sum%s %s\n", v.name, wrapLabels(labels), formatFloat(math.Float64frombits(atomic.LoadUint64(&s.sum))))
+			fmt.Fprintf(cw, "%s_count%s %d\n", v.name, wrapLabels(labels), atomic.LoadUint64(&s.count))
+		}
+	}
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// Handler 返回输出指标的 http 处理器，可以挂载到 /metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func formatLabels(names []string, values []string) []string {
+	labels := make([]string, len(names))
+	for i, name := range names {
+		labels[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return labels
+}
+
+func wrapLabels(labels []string, extra ...string) string {
+	all := append(append([]string(nil), labels...), extra...)
+	if len(all) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(all, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelReplacer.Replace(s) }
+func escapeHelp(s string) string  { return helpReplacer.Replace(s) }
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests, err := r.Counter("test_requests_total", "请求数\n第二行", "method", "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns, err := r.Gauge("test_connections", "连接数", "transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	duration, err := r.Histogram("test_duration_seconds", "耗时", []float64{0.1, 1}, "method")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests.Inc("user.info", "0")
+	requests.Add(2, "user.info", "0")
+	requests.Inc(`a"b\c`, "-32601")
+	conns.Add(2, "tcp")
+	conns.Add(-1, "tcp")
+	conns.Set(0.5, "http")
+	duration.Observe(0.05, "user.info")
+	duration.Observe(0.5, "user.info")
+	duration.Observe(3, "user.info")
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo = %d, %v, written %d", n, err, buf.Len())
+	}
+	want := `# HELP test_requests_total 请求数\n第二行
+# TYPE test_requests_total counter
+test_requests_total{method="a\"b\\c",code="-32601"} 1
+test_requests_total{method="user.info",code="0"} 3
+# HELP test_connections 连接数
+# TYPE test_connections gauge
+test_connections{transport="http"} 0.5
+test_connections{transport="tcp"} 1
+# HELP test_duration_seconds 耗时
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="user.info",le="0.1"} 1
+test_duration_seconds_bucket{method="user.info",le="1"} 2
+test_duration_seconds_bucket{method="user.info",le="+Inf"} 3
+test_duration_seconds_sum{method="user.info"} 3.55
+test_duration_seconds_count{method="user.info"} 3
+`
+	if buf.String() != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRegistryConflict(t *testing.T) {
+	r := NewRegistry()
+	c1, err := r.Counter("test_total", "", "method")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同名同类型的指标共享
+	c2, err := r.Counter("test_total", "", "method")
+	if err != nil || c2.v != c1.v {
+		t.Errorf("same counter = %v, %v", c2, err)
+	}
+	if _, err = r.Gauge("test_total", "", "method"); err == nil {
+		t.Error("want error for different kind")
+	}
+	if _, err = r.Counter("test_total", "", "method", "code"); err == nil {
+		t.Error("want error for different labels")
+	}
+	if _, err = r.Histogram("test_seconds", "", []float64{1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Histogram("test_seconds", "", []float64{1, 2}); err == nil {
+		t.Error("want error for different buckets")
+	}
+
+	// 标签值数量错误时忽略本次记录，不 panic
+	c1.Inc("a", "b")
+	c1.Inc()
+	var buf bytes.Buffer
+	_, _ = r.WriteTo(&buf)
+	if strings.Contains(buf.String(), "test_total{") {
+		t.Errorf("series recorded with wrong label count:\n%s", buf.String())
+	}
+}
+
+func TestSetMetricsConflict(t *testing.T) {
+	r := NewRegistry()
+	svr := &Server{}
+	if err := svr.SetMetrics(r); err != nil {
+		t.Fatal(err)
+	}
+	sm := svr.Metrics()
+	// 多个服务共享同一个注册表
+	if err := (&Server{}).SetMetrics(r); err != nil {
+		t.Errorf("shared registry: %v", err)
+	}
+
+	conflict := NewRegistry()
+	if _, err := conflict.Gauge("jsonrpc_server_requests_total", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.SetMetrics(conflict); err == nil {
+		t.Error("want error for conflicting registry")
+	}
+	if svr.Metrics() != sm {
+		t.Error("metrics replaced after failed SetMetrics")
+	}
+	if _, err := NewClientMetrics(conflict); err != nil {
+		t.Errorf("client metrics: %v", err)
+	}
+	if _, err := conflict.Counter("jsonrpc_client_retries_total", "", "code"); err == nil {
+		t.Error("want error for client metric registered with other labels")
+	}
+	conflict = NewRegistry()
+	if _, err := conflict.Counter("jsonrpc_client_retries_total", "", "code"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClientMetrics(conflict); err == nil {
+		t.Error("want error for conflicting client metrics")
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,17 +24,21 @@ var RequiredFields = map[string]string{
 
 // Request 请求参数列表
 type Request struct {
-	Id      string      `json:"id"`
-	JsonRpc string      `json:"jsonrpc"`
-	Method  string      `json:"method"`
-	Params  interface{} `json:"params"`
+	Id      string       `json:"id"`
+	JsonRpc string       `json:"jsonrpc"`
+	Method  string       `json:"method"`
+	Params  interface{}  `json:"params"`
+	Sign    *Signature   `json:"sign,omitempty"`
+	Trace   TraceCarrier `json:"trace,omitempty"`
 }
 
 // NotifyRequest 异常请求参数列表
 type NotifyRequest struct {
-	JsonRpc string      `json:"jsonrpc"`
-	Method  string      `json:"method"`
-	Params  interface{} `json:"params"`
+	JsonRpc string       `json:"jsonrpc"`
+	Method  string       `json:"method"`
+	Params  interface{}  `json:"params"`
+	Sign    *Signature   `json:"sign,omitempty"`
+	Trace   TraceCarrier `json:"trace,omitempty"`
 }
 
 // SingleRequest 客户端参数结构体
@@ -124,6 +129,7 @@ func ParseRequestMethod(method string) (sName string, mName string, err error) {
 // Rs 参数组装
 func Rs(id interface{}, method string, params interface{}) interface{} {
 	var req interface{}
+	params = StructuredParams(params)
 	if id != nil {
 		req = Request{Id: id.(string), JsonRpc: JsonRpc, Method: method, Params: params}
 	} else {
@@ -132,60 +138,33 @@ func Rs(id interface{}, method string, params interface{}) interface{} {
 	return req
 }
 
+// StructuredParams 协议要求 params 为对象或数组，基础类型的参数包装为只有一个元素的数组
+func StructuredParams(params interface{}) interface{} {
+	if params == nil {
+		return nil
+	}
+	if _, ok := params.(json.Marshaler); ok {
+		return params
+	}
+	v := reflect.Indirect(reflect.ValueOf(params))
+	switch v.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []interface{}{params}
+	}
+	return params
+}
+
 func JsonBatchRs(data []interface{}) []byte {
 	e, _ := json.Marshal(data)
 	return e
 }
 
+// GetStruct 将解析后的 json 数据转换到结构体指针 s 中，字段按 json 标签匹配
 func GetStruct(d interface{}, s interface{}) error {
-	var (
-		m string
-		t reflect.Type
-	)
-
-	// 检测类型是否为Ptr
-	if reflect.TypeOf(s).Kind() != reflect.Ptr {
-		m = fmt.Sprintf("无效的类型元素 %s，需要类型为指针", reflect.TypeOf(s))
-		Debug(m)
-		return errors.New(m)
-	}
-	t = reflect.TypeOf(s).Elem() // 获取值类型的数据  TypeOf 返回接口值类型 Elem 获取指向类型的数据
-	var jsonMap = make(map[string]interface{}, 0)
-	// reflect.TypeOf(d).Kind() 返回具体类型
-	switch reflect.TypeOf(d).Kind() {
-	case reflect.Map:
-		if t.NumField() != len(d.(map[string]interface{})) {
-			m = fmt.Sprintf("json：参数个数不匹配")
-			Debug(m)
-			return errors.New(m)
-		}
-		for k := 0; k < t.NumField(); k++ {
-			lk := strings.ToLower(t.Field(k).Name) // 转换字符为小写
-			if _, ok := d.(map[string]interface{})[lk]; ok != true {
-				m = fmt.Sprintf("json: 找不到该字段 %s", lk)
-				Debug(m)
-				return errors.New(m)
-			}
-		}
-		jsonMap = d.(map[string]interface{})
-		break
-	case reflect.Slice:
-		// 字段数量不匹配
-		if t.NumField() != reflect.ValueOf(d).Len() {
-			m = fmt.Sprintf("参数数量不匹配 [%s] [%s]", t.NumField(), reflect.ValueOf(d).Len())
-			Debug(m)
-			return errors.New(m)
-		}
-
-		for k := 0; k < t.NumField(); k++ {
-			jsonMap[t.Field(k).Name] = reflect.ValueOf(d).Index(k).Interface()
-		}
-		break
-	default:
-		break
-	}
-	if err := gconv.Struct(jsonMap, s); err != nil {
-		Debug(err)
+	if err := BindParams(d, s, false); err != nil {
+		Debug(err.Error())
 		return err
 	}
 	return nil
@@ -195,3 +174,40 @@ func JsonRs(id interface{}, method string, params interface{}) []byte {
 	e, _ := json.Marshal(Rs(id, method, params))
 	return e
 }
+
+// EncodeRequest 按编码序列化 Rs 生成的请求或请求列表，参数不经过 json 转换
+// signer 不为 nil 时为每个请求签名，tracing 不为 nil 时为每个请求添加 ctx 中的 trace context
+func EncodeRequest(ctx context.Context, c Codec, body interface{}, signer *Signer, tracing *Tracing) ([]byte, error) {
+	carrier := tracing.carrier(ctx)
+	prepare := func(req interface{}) (interface{}, error) {
+		var err error
+		switch r := req.(type) {
+		case Request:
+			r.Trace = carrier
+			if signer != nil {
+				r.Sign, err = signer.signParams(r.Method, r.Params)
+			}
+			return r, err
+		case NotifyRequest:
+			r.Trace = carrier
+			if signer != nil {
+				r.Sign, err = signer.signParams(r.Method, r.Params)
+			}
+			return r, err
+		}
+		return req, nil
+	}
+	var err error
+	if list, ok := body.([]interface{}); ok {
+		prepared := make([]interface{}, len(list))
+		for i, req := range list {
+			if prepared[i], err = prepare(req); err != nil {
+				return nil, err
+			}
+		}
+		body = prepared
+	} else if body, err = prepare(body); err != nil {
+		return nil, err
+	}
+	return Encode(c, body)
+}
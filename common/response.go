@@ -3,13 +3,11 @@ package common
 import (
 	"encoding/json"
 	"errors"
-	"github.com/gogf/gf/v2/util/gconv"
-	"reflect"
 )
 
 // SuccessResponse 成功响应
 type SuccessResponse struct {
-	Id      string      `json:"id"`
+	Id      interface{} `json:"id"`
 	JsonRpc string      `json:"jsonrpc"`
 	Result  interface{} `json:"result"`
 }
@@ -27,11 +25,16 @@ type Error struct {
 	Data    interface{} `json:"data"`
 }
 
+// Error 客户端收到的错误响应，错误信息与服务端返回的 message 一致，可以通过类型断言获取错误码与详情
+func (e *Error) Error() string {
+	return e.Message
+}
+
 // ErrorResponse 错误响应
 type ErrorResponse struct {
-	Id      string `json:"id"`
-	JsonRpc string `json:"jsonrpc"`
-	Error   Error  `json:"error"`
+	Id      interface{} `json:"id"`
+	JsonRpc string      `json:"jsonrpc"`
+	Error   Error       `json:"error"`
 }
 
 // ErrorNotifyResponse 异常错误响应
@@ -40,6 +43,17 @@ type ErrorNotifyResponse struct {
 	Error   Error  `json:"error"`
 }
 
+// responseError 返回错误响应中的错误，成功响应返回 nil
+func responseError(res interface{}) *Error {
+	switch r := res.(type) {
+	case ErrorResponse:
+		return &r.Error
+	case ErrorNotifyResponse:
+		return &r.Error
+	}
+	return nil
+}
+
 // E 业务参数响应返回
 func E(id interface{}, jsonRpc string, errCode int) interface{} {
 	e := Error{
@@ -50,13 +64,26 @@ func E(id interface{}, jsonRpc string, errCode int) interface{} {
 
 	var res interface{}
 	if id != nil {
-		res = ErrorResponse{Id: id.(string), JsonRpc: jsonRpc, Error: e}
+		res = ErrorResponse{Id: id, JsonRpc: jsonRpc, Error: e}
 	} else {
 		res = ErrorNotifyResponse{JsonRpc: jsonRpc, Error: e}
 	}
 	return res
 }
 
+// ED 携带错误详情的响应返回
+func ED(id interface{}, jsonRpc string, errCode int, data interface{}) interface{} {
+	e := Error{
+		Code:    errCode,
+		Message: CodeMap[errCode],
+		Data:    data,
+	}
+	if id != nil {
+		return ErrorResponse{Id: id, JsonRpc: jsonRpc, Error: e}
+	}
+	return ErrorNotifyResponse{JsonRpc: jsonRpc, Error: e}
+}
+
 func CE(id interface{}, jsonRpc string, errMessage string) interface{} {
 	e := Error{
 		Code:    CustomError,
@@ -65,7 +92,7 @@ func CE(id interface{}, jsonRpc string, errMessage string) interface{} {
 	}
 	var res interface{}
 	if id != nil {
-		res = ErrorResponse{id.(string), jsonRpc, e}
+		res = ErrorResponse{id, jsonRpc, e}
 	} else {
 		res = ErrorNotifyResponse{jsonRpc, e}
 	}
@@ -75,7 +102,7 @@ func CE(id interface{}, jsonRpc string, errMessage string) interface{} {
 func S(id interface{}, jsonRpc string, result interface{}) interface{} {
 	var res interface{}
 	if id != nil {
-		res = SuccessResponse{id.(string), jsonRpc, result}
+		res = SuccessResponse{id, jsonRpc, result}
 	} else {
 		res = SuccessNotifyResponse{jsonRpc, result}
 	}
@@ -88,30 +115,85 @@ func jsonE(id interface{}, jsonRpc string, errCode int) []byte {
 	return e
 }
 
-// GetResult 获取接口返回信息
+// GetResult 获取接口返回信息，只解析协议字段，结果按目标类型解析一次
 func GetResult(b []byte, result interface{}) error {
-	var (
-		err      error
-		jsonData interface{}
-	)
-	err = json.Unmarshal(b, &jsonData)
+	list, batch, err := SplitBatch(b)
 	if err != nil {
 		Debug(err)
+		return err
 	}
+	if !batch {
+		return getRawResponse(list[0], result)
+	}
+	requests, _ := result.([]*SingleRequest)
+	for k, v := range list {
+		if k >= len(requests) {
+			break
+		}
+		err = getRawResponse(v, requests[k].Result)
+		if err != nil && requests[k].Error != nil {
+			*(requests[k].Error) = err
+		}
+	}
+	return nil
+}
+
+// DecodeResult 按编码解析响应，结果直接由该编码解析到目标类型，批量请求的 result 为 []*SingleRequest
+func DecodeResult(c Codec, b []byte, result interface{}) error {
+	rc, ok := AsRawCodec(c)
+	if !ok {
+		data, err := ToJSON(c, b)
+		if err != nil {
+			return err
+		}
+		return GetResult(data, result)
+	}
+	if IsJSON(rc) {
+		return GetResult(b, result)
+	}
+	list, err := rc.UnmarshalArray(b)
+	if err != nil {
+		return decodeResponse(rc, b, result)
+	}
+	requests, _ := result.([]*SingleRequest)
+	for k, v := range list {
+		if k >= len(requests) {
+			break
+		}
+		err = decodeResponse(rc, v, requests[k].Result)
+		if err != nil && requests[k].Error != nil {
+			*(requests[k].Error) = err
+		}
+	}
+	return nil
+}
 
-	// 判断返回值类型是否为 Map
-	if reflect.ValueOf(jsonData).Kind() == reflect.Map {
-		if err = GetSingleResponse(jsonData.(map[string]interface{}), result); err != nil {
+// decodeResponse 按 json 以外的编码解析单一请求的响应
+func decodeResponse(c RawCodec, b []byte, result interface{}) error {
+	fields, err := c.UnmarshalObject(b)
+	if err != nil {
+		Debug(err)
+		return err
+	}
+	if raw, ok := fields["error"]; ok {
+		var e *Error
+		if err = c.Unmarshal(raw, &e); err != nil {
 			return err
 		}
-	} else if reflect.ValueOf(jsonData).Kind() == reflect.Slice {
-		for k, v := range jsonData.([]interface{}) {
-			err = GetSingleResponse(v.(map[string]interface{}), result.([]*SingleRequest)[k].Result)
-			if err != nil {
-				*(result.([]*SingleRequest)[k].Error) = err
-			}
+		if e != nil {
+			// data 中的数字与 json 解析的结果一致
+			e.Data = plainNumbers(fromCodec(e.Data))
+			Debug(e.Message)
+			return e
 		}
 	}
+	if result == nil {
+		return nil
+	}
+	if err = decodeValue(c, fields["result"], result, false); err != nil {
+		Debug(err)
+		return err
+	}
 	return nil
 }
 
@@ -126,7 +208,11 @@ func GetSingleResponse(jsonMap map[string]interface{}, result interface{}) error
 		return errors.New(resErr.Message)
 	}
 	// 处理返回结果值
-	if err = gconv.Struct(jsonMap["result"], result); err != nil {
+	if result == nil {
+		return nil
+	}
+	// 结果可以是结构体、基础类型、切片、map 等任意类型
+	if err = BindParams(jsonMap["result"], result, false); err != nil {
 		Debug(err)
 		return err
 	}
@@ -0,0 +1,168 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// TransportError 网络等传输层错误，请求可能未到达服务端或响应丢失
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// RetryPolicy 客户端重试策略，只重试幂等的方法，通知请求不重试
+type RetryPolicy struct {
+	MaxAttempts    int           // 最大尝试次数，包括第一次，不大于 1 时不重试
+	InitialBackoff time.Duration // 第一次重试前的等待时间，为 0 时为 100ms
+	MaxBackoff     time.Duration // 最长等待时间，为 0 时为 5s
+	Multiplier     float64       // 每次重试等待时间的倍数，不大于 1 时为 2
+	Jitter         float64       // 等待时间随机浮动的比例 0 ~ 1，如 0.2 表示在 ±20% 内浮动
+
+	// RetryableCodes 可以重试的 JSON-RPC 错误码，为 nil 时为 RateLimited 与 Overloaded
+	// 限流错误按服务端返回的 retryAfter 与退避时间中较长的一个等待
+	RetryableCodes []int
+	// Retryable 自定义是否重试，为 nil 时重试 RetryableCodes 中的错误与 TransportError
+	Retryable func(err error) bool
+	// Idempotent 幂等的方法，支持 user.*、*.get 等通配，兼容大驼峰、小驼峰与下划线，只有幂等的方法会重试
+	Idempotent []string
+	// OnRetry 每次重试前调用，attempt 为即将进行的第几次尝试，可用于记录日志
+	OnRetry func(ctx context.Context, method string, attempt int, err error, delay time.Duration)
+}
+
+// IsIdempotent 方法是否为幂等方法
+func (r *RetryPolicy) IsIdempotent(method string) bool {
+	for _, pattern := range r.Idempotent {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryable 错误是否可以重试
+func (r *RetryPolicy) IsRetryable(err error) bool {
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+	switch e := err.(type) {
+	case *TransportError:
+		return true
+	case *Error:
+		codes := r.RetryableCodes
+		if codes == nil {
+			codes = []int{RateLimited, Overloaded}
+		}
+		for _, code := range codes {
+			if code == e.Code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Backoff 第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (r *RetryPolicy) Backoff(attempt int) time.Duration {
+	initial, max, multiplier := r.InitialBackoff, r.MaxBackoff, r.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 5 * time.Second
+	}
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if r.Jitter > 0 {
+		d += d * r.Jitter * (rand.Float64()*2 - 1)
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	return time.Duration(d)
+}
+
+// BatchMethod 批量请求重试时传递给 OnRetry 的方法名
+const BatchMethod = "jsonrpc.batch"
+
+// Do 按重试策略执行 call，method 不是幂等方法或 r 为 nil 时只执行一次，返回最后一次的错误
+// call 的 attempt 从 1 开始
+func (r *RetryPolicy) Do(ctx context.Context, method string, call func(attempt int) error) error {
+	return r.do(ctx, method, r != nil && r.IsIdempotent(method), call)
+}
+
+// DoBatch 按重试策略执行批量请求，所有方法都是幂等方法时才重试，只重试整个批量请求失败的错误
+func (r *RetryPolicy) DoBatch(ctx context.Context, methods []string, call func(attempt int) error) error {
+	idempotent := r != nil && len(methods) > 0
+	for _, method := range methods {
+		if idempotent && !r.IsIdempotent(method) {
+			idempotent = false
+		}
+	}
+	return r.do(ctx, BatchMethod, idempotent, call)
+}
+
+func (r *RetryPolicy) do(ctx context.Context, method string, idempotent bool, call func(attempt int) error) error {
+	err := call(1)
+	if !idempotent || r.MaxAttempts <= 1 {
+		return err
+	}
+	for attempt := 2; attempt <= r.MaxAttempts && err != nil && r.IsRetryable(err); attempt++ {
+		delay := r.Backoff(attempt - 1)
+		if after := retryAfter(err); after > delay {
+			delay = after
+		}
+		if r.OnRetry != nil {
+			r.OnRetry(ctx, method, attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = call(attempt)
+	}
+	return err
+}
+
+// retryAfter 限流错误中服务端建议的等待时间，data 可以是 RateLimitData 或解码后的任意 json 对象
+func retryAfter(err error) time.Duration {
+	e, ok := err.(*Error)
+	if !ok || e.Code != RateLimited || e.Data == nil {
+		return 0
+	}
+	var data RateLimitData
+	switch d := e.Data.(type) {
+	case RateLimitData:
+		data = d
+	case *RateLimitData:
+		if d == nil {
+			return 0
+		}
+		data = *d
+	default:
+		// map、json.RawMessage 与其它类型统一转换为 json 后读取 retryAfter
+		b, err := json.Marshal(e.Data)
+		if err != nil || json.Unmarshal(b, &data) != nil {
+			return 0
+		}
+	}
+	if data.RetryAfter <= 0 {
+		return 0
+	}
+	return time.Duration(data.RetryAfter * float64(time.Second))
+}
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	r := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 300 * time.Millisecond, 3: 900 * time.Millisecond, 4: time.Second, 10: time.Second} {
+		if got := r.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	// 默认 100ms 起，每次翻倍，最长 5s
+	defaults := &RetryPolicy{}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 20: 5 * time.Second} {
+		if got := defaults.Backoff(attempt); got != want {
+			t.Errorf("default Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	jitter := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if got := jitter.Backoff(1); got < 80*time.Millisecond || got > 120*time.Millisecond {
+			t.Fatalf("jittered Backoff(1) = %v, want 80ms ~ 120ms", got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var nilData *RateLimitData
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"map", rpcError(RateLimited, map[string]interface{}{"retryAfter": 1.5}), 1500 * time.Millisecond},
+		{"json number", rpcError(RateLimited, map[string]interface{}{"retryAfter": json.Number("2")}), 2 * time.Second},
+		{"typed", rpcError(RateLimited, RateLimitData{RetryAfter: 0.25}), 250 * time.Millisecond},
+		{"pointer", rpcError(RateLimited, &RateLimitData{RetryAfter: 3}), 3 * time.Second},
+		{"raw message", rpcError(RateLimited, json.RawMessage(`{"retryAfter":0.5}`)), 500 * time.Millisecond},
+		{"nil pointer", rpcError(RateLimited, nilData), 0},
+		{"no data", rpcError(RateLimited, nil), 0},
+		{"other data", rpcError(RateLimited, "slow down"), 0},
+		{"negative", rpcError(RateLimited, RateLimitData{RetryAfter: -1}), 0},
+		{"other code", rpcError(Overloaded, RateLimitData{RetryAfter: 1}), 0},
+		{"transport", &TransportError{Err: errors.New("reset")}, 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.err); got != tt.want {
+			t.Errorf("%s: retryAfter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// rpcError 客户端收到的错误响应
+func rpcError(code int, data interface{}) error {
+	return &Error{Code: code, Message: CodeMap[code], Data: data}
+}
+
+func TestRetryDo(t *testing.T) {
+	rateLimited := rpcError(RateLimited, RateLimitData{RetryAfter: 0.05})
+	policy := func(delays *[]time.Duration) *RetryPolicy {
+		return &RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Idempotent:     []string{"user.get*"},
+			OnRetry: func(ctx context.Context, method string, attempt int, err error, delay time.Duration) {
+				*delays = append(*delays, delay)
+			},
+		}
+	}
+	calls := func(r *RetryPolicy, method string, errs ...error) (int, error) {
+		n := 0
+		err := r.Do(context.Background(), method, func(attempt int) error {
+			n++
+			if attempt != n {
+				t.Errorf("attempt = %d, want %d", attempt, n)
+			}
+			if n <= len(errs) {
+				return errs[n-1]
+			}
+			return nil
+		})
+		return n, err
+	}
+	transport := &TransportError{Err: errors.New("reset")}
+
+	var delays []time.Duration
+	if n, err := calls(policy(&delays), "user.getInfo", transport, rateLimited); n != 3 || err != nil {
+		t.Errorf("retried calls = %d, %v", n, err)
+	}
+	// 限流时按 retryAfter 与退避时间中较长的一个等待
+	if len(delays) != 2 || delays[0] != time.Millisecond || delays[1] != 50*time.Millisecond {
+		t.Errorf("delays = %v", delays)
+	}
+
+	delays = nil
+	if n, err := calls(policy(&delays), "user.getInfo", transport, transport, transport, transport); n != 3 || err != transport {
+		t.Errorf("exhausted calls = %d, %v", n, err)
+	}
+	notFound := rpcError(MethodNotFound, nil)
+	if n, _ := calls(policy(&delays), "user.getInfo", notFound); n != 1 {
+		t.Errorf("non retryable error retried %d times", n)
+	}
+	if n, _ := calls(policy(&delays), "user.delete", transport); n != 1 {
+		t.Errorf("non idempotent method called %d times", n)
+	}
+	var nilPolicy *RetryPolicy
+	if n, _ := calls(nilPolicy, "user.getInfo", transport); n != 1 {
+		t.Errorf("nil policy called %d times", n)
+	}
+
+	// 批量请求只有所有方法都是幂等方法时才重试
+	for methods, want := range map[string]int{"user.getInfo,user.getName": 3, "user.getInfo,user.delete": 1} {
+		n := 0
+		_ = policy(&delays).DoBatch(context.Background(), strings.Split(methods, ","), func(attempt int) error {
+			n++
+			return transport
+		})
+		if n != want {
+			t.Errorf("batch %s called %d times, want %d", methods, n, want)
+		}
+	}
+}
+
+// 等待重试时 ctx 取消立即返回最后一次的错误
+func TestRetryContextCanceled(t *testing.T) {
+	r := &RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Second, Idempotent: []string{"*"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	transport := &TransportError{Err: errors.New("reset")}
+	n := 0
+	start := time.Now()
+	err := r.Do(ctx, "user.get", func(attempt int) error {
+		n++
+		return transport
+	})
+	if err != transport || n != 1 {
+		t.Errorf("Do = %v after %d calls", err, n)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Do returned after %v", d)
+	}
+}
@@ -1,14 +1,17 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gogf/gf/v2/errors/gerror"
-	"github.com/gogf/gf/v2/util/gconv"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
@@ -17,6 +20,11 @@ type Method struct {
 	ParamsType reflect.Type
 	ResultType reflect.Type
 	Method     reflect.Method
+	Func       reflect.Value // 方法或函数的实现
+	Receiver   bool          // 调用时是否需要传入服务实例
+	Context    bool          // 第一个参数是否为 context.Context
+	Validate   bool          // 参数结构体是否声明了 v 标签校验规则
+	Stream     bool          // 是否为流式方法，结果通过 *Stream 分片推送
 }
 
 // Service 服务实例
@@ -25,13 +33,33 @@ type Service struct {
 	V    reflect.Value
 	T    reflect.Type
 	Mm   map[string]*Method
+
+	Skipped []*MethodError // 宽松模式下因签名错误被跳过的导出方法
 }
 
 // Server 服务
 type Server struct {
-	Sm          sync.Map      // 开启锁
-	Hooks       Hooks         // 勾子函数
-	RateLimiter *rate.Limiter // 限流器
+	Sm           sync.Map       // 开启锁
+	Hooks        Hooks          // 勾子函数
+	RateLimiter  *rate.Limiter  // 限流器
+	Info         OpenRPCInfo    // rpc.discover 返回文档的基础信息
+	Naming       NamingStrategy // 服务名与方法名的对外命名策略，需要在注册服务前设置
+	aliases      sync.Map       // 方法别名 别名 => 完整方法名
+	Strict       bool           // 严格模式，服务存在签名错误的导出方法时注册失败
+	StrictParams bool           // 参数严格模式，不允许未知字段、缺少必填字段以及类型转换
+	mu           sync.Mutex     // 注册服务时加锁
+	rateLimiters atomic.Value   // 按分组限流的规则 []*rateLimiter
+
+	inFlight          atomic.Value // 所有方法的并发限制 semaphore
+	methodConcurrency sync.Map     // 单个方法的并发限制 服务名.方法名 => *Semaphore
+	auth              atomic.Value // 认证配置 *AuthOptions
+	acl               atomic.Value // 访问控制规则 aclHolder
+	sign              atomic.Value // 签名校验配置 *SignOptions
+	metrics           atomic.Value // 服务端指标 *ServerMetrics
+	log               atomic.Value // 访问日志配置 *LogOptions
+	tracing           atomic.Value // 链路追踪 *Tracing
+	healthChecks      sync.Map     // 健康检查 名称 => HealthCheck
+	notReady          int32        // 未就绪，关闭服务时设置
 }
 
 type Hooks struct {
@@ -41,37 +69,103 @@ type Hooks struct {
 
 // Handler 处理参数与请求
 func (svr *Server) Handler(b []byte) []byte {
-	// 把参数解析为 json
-	data, err := ParseRequestBody(b)
+	return svr.HandlerContext(context.Background(), b)
+}
+
+// HandlerContext 携带上下文处理 json 请求，支持推送的协议通过 WithSender 传入写入函数
+func (svr *Server) HandlerContext(ctx context.Context, b []byte) []byte {
+	return svr.HandlerCodec(ctx, JSON, b)
+}
+
+// HandlerCodec 按指定编码处理请求，返回同一编码的响应，WithSender 传入的写入函数同样接收该编码的数据
+// 实现了 RawCodec 的编码直接解析请求与序列化响应，其它编码与 json 相互转换
+func (svr *Server) HandlerCodec(ctx context.Context, c Codec, b []byte) []byte {
+	rc, ok := AsRawCodec(c)
+	if !ok {
+		return svr.handleBridge(ctx, c, b)
+	}
+	// 拆分批量请求，每个请求的 params 保持原始数据
+	list, batch, err := splitBatch(rc, b)
 	if err != nil {
-		return jsonE(nil, JsonRpc, ParseError)
+		DebugContext(ctx, err)
+		response, _ := rc.Marshal(E(nil, JsonRpc, ParseError))
+		return response
 	}
 	var res interface{}
-	if reflect.ValueOf(data).Kind() == reflect.Slice { // 检测参数类型是否为切片 slice 类型
-		var resList []interface{}
-		for _, v := range data.([]interface{}) {
-			r := svr.SingleHandler(v.(map[string]interface{}))
-			resList = append(resList, r)
+	if batch && len(list) == 0 {
+		res = E(nil, JsonRpc, InvalidRequest)
+	} else if batch {
+		if sm := svr.Metrics(); sm != nil {
+			sm.BatchSize.Observe(float64(len(list)))
+		}
+		resList := make([]interface{}, 0, len(list))
+		for i, v := range list {
+			resList = append(resList, svr.handleSingle(withBatchIndex(ctx, i), rc, v))
 		}
 		res = resList
-	} else if reflect.ValueOf(data).Kind() == reflect.Map { // 检测参数类型为 Map 类型
-		r := svr.SingleHandler(data.(map[string]interface{}))
-
-		res = r
 	} else {
-		return jsonE(nil, JsonRpc, InvalidRequest)
+		res = svr.handleSingle(ctx, rc, list[0])
 	}
-	response, _ := json.Marshal(res)
+	response, _ := rc.Marshal(res)
 
 	return response
 }
 
+// splitBatch 拆分批量请求，单个请求需要是对象
+func splitBatch(c RawCodec, b []byte) (list [][]byte, batch bool, err error) {
+	if IsJSON(c) {
+		raw, batch, err := SplitBatch(b)
+		return rawList(raw), batch, err
+	}
+	if list, err = c.UnmarshalArray(b); err == nil {
+		return list, true, nil
+	}
+	if _, err = c.UnmarshalObject(b); err != nil {
+		return nil, false, err
+	}
+	return [][]byte{b}, false, nil
+}
+
+// handleBridge 未实现 RawCodec 的编码转换为 json 后处理，流式分片同样转换为该编码
+func (svr *Server) handleBridge(ctx context.Context, c Codec, b []byte) []byte {
+	data, err := ToJSON(c, b)
+	if err != nil {
+		DebugContext(ctx, err)
+		data = jsonE(nil, JsonRpc, ParseError)
+	} else {
+		if send := SenderFromContext(ctx); send != nil {
+			ctx = WithSender(ctx, func(b []byte) error {
+				b, err := FromJSON(c, b)
+				if err != nil {
+					return err
+				}
+				return send(b)
+			})
+		}
+		data = svr.HandlerCodec(ctx, JSON, data)
+	}
+	response, err := FromJSON(c, data)
+	if err != nil {
+		DebugContext(ctx, err)
+	}
+	return response
+}
+
 func (svr *Server) Register(s interface{}) error {
-	svc := new(Service)                              // 分配零值
-	svc.V = reflect.ValueOf(s)                       // 获取值的对象
-	svc.T = reflect.TypeOf(s)                        // 获取 interface 的具体类型
-	svc.Name = reflect.Indirect(svc.V).Type().Name() // 返回 srv.V 指定的值 如果v是个nil指针，Indirect返回0值，如果v不是指针，Indirect返回v本身
-	svc.Mm = RegisterMethods(svc.T)
+	// 返回 srv.V 指定的值 如果v是个nil指针，Indirect返回0值，如果v不是指针，Indirect返回v本身
+	name := reflect.Indirect(reflect.ValueOf(s)).Type().Name()
+	return svr.RegisterName(svr.Naming.ServiceName(name), s)
+}
+
+// RegisterName 以指定的名称注册服务，方法名按命名策略生成
+// 严格模式下存在签名错误的导出方法时整个服务注册失败，宽松模式下跳过这些方法并记录到 Service.Skipped
+func (svr *Server) RegisterName(name string, s interface{}) error {
+	svc, err := svr.newService(name, s)
+	if err != nil {
+		return err
+	}
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
 	// 判断服务是否已经注册过
 	if _, err := svr.Sm.LoadOrStore(svc.Name, svc); err {
 		return gerror.New("当前服务已经注册过，请勿重新注册")
@@ -79,62 +173,218 @@ func (svr *Server) Register(s interface{}) error {
 	return nil
 }
 
-// RegisterMethods 注册方法
-func RegisterMethods(s reflect.Type) map[string]*Method {
+// Replace 替换已注册的服务，正在进行的调用继续使用旧的服务实例完成
+// 通过 RegisterFunc 追加的方法会保留，新的服务存在同名方法时使用新的方法
+func (svr *Server) Replace(name string, s interface{}) error {
+	svc, err := svr.newService(name, s)
+	if err != nil {
+		return err
+	}
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	old, ok := svr.Sm.Load(name)
+	if !ok {
+		return gerror.Newf("服务 %s 未注册，无法替换", name)
+	}
+	for k, m := range old.(*Service).Mm {
+		if _, ok = svc.Mm[k]; !ok && !m.Receiver {
+			svc.Mm[k] = m
+		}
+	}
+	svr.Sm.Store(name, svc)
+	return nil
+}
+
+// Unregister 注销服务，正在进行的调用不受影响，之后的调用返回方法不存在
+func (svr *Server) Unregister(name string) error {
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	if _, ok := svr.Sm.LoadAndDelete(name); !ok {
+		return gerror.Newf("服务 %s 未注册，无法注销", name)
+	}
+	return nil
+}
+
+// newService 通过反射生成服务实例
+func (svr *Server) newService(name string, s interface{}) (*Service, error) {
+	svc := new(Service)        // 分配零值
+	svc.V = reflect.ValueOf(s) // 获取值的对象
+	svc.T = reflect.TypeOf(s)  // 获取 interface 的具体类型
+	svc.Name = name
+	svc.Mm = make(map[string]*Method, 0)
+	mm, skipped := RegisterMethods(svc.T)
+	if len(skipped) > 0 && (svr.Strict || len(mm) == 0) {
+		return nil, &RegisterError{Service: name, Methods: skipped}
+	}
+	// 宽松模式下注册成功，跳过的方法通过日志与 Service.Skipped 提示
+	for _, e := range skipped {
+		GetLogger().Log(context.Background(), LevelWarn, "rpc register skipped", Field{"service", name}, Field{"method", e.Method}, Field{"reason", e.Reason})
+	}
+	svc.Skipped = skipped
+	for k, m := range mm {
+		m.Name = svr.Naming.MethodName(k)
+		svc.Mm[m.Name] = m
+	}
+	return svc, nil
+}
+
+// RegisterFunc 将函数注册为指定名称的方法，name 为完整的方法名 如 math.add，服务名与方法名按命名策略转换
+// 服务已存在时会复制一份新的服务追加该方法，不影响正在进行的调用
+func (svr *Server) RegisterFunc(name string, fn interface{}) error {
+	sName, mName, err := SplitMethod(name)
+	if err != nil {
+		return err
+	}
+	sName, mName = svr.Naming.ServiceName(sName), svr.Naming.MethodName(mName)
+	m, me := RegisterFunc(mName, fn)
+	if me != nil {
+		return &RegisterError{Service: sName, Methods: []*MethodError{me}}
+	}
+
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	svc := &Service{Name: sName, Mm: make(map[string]*Method, 1)}
+	if s, ok := svr.Sm.Load(sName); ok {
+		old := s.(*Service)
+		if _, ok = old.Mm[mName]; ok {
+			return gerror.Newf("方法 %s 已经注册过，请勿重新注册", svr.Naming.Join(sName, mName))
+		}
+		svc.V, svc.T = old.V, old.T
+		for k, v := range old.Mm {
+			svc.Mm[k] = v
+		}
+	}
+	svc.Mm[mName] = m
+	svr.Sm.Store(sName, svc)
+	return nil
+}
+
+// Alias 为已注册的方法设置别名，method 为完整的对外方法名
+func (svr *Server) Alias(alias string, method string) error {
+	sName, mName, err := SplitMethod(method)
+	if err != nil {
+		return err
+	}
+	if _, _, ok := svr.lookup(sName, mName); !ok {
+		return gerror.Newf("方法 %s 不存在，无法设置别名", method)
+	}
+	svr.aliases.Store(strings.TrimLeft(alias, "./"), [2]string{sName, mName})
+	return nil
+}
+
+// Lookup 根据请求的方法名查找服务与方法，依次匹配别名与命名策略
+func (svr *Server) Lookup(method string) (*Service, *Method, bool) {
+	if target, ok := svr.aliases.Load(strings.TrimLeft(method, "./")); ok {
+		return svr.lookup(target.([2]string)[0], target.([2]string)[1])
+	}
+	sName, mName, err := SplitMethod(method)
+	if err != nil {
+		Debug(err.Error())
+		return nil, nil, false
+	}
+	return svr.lookup(sName, mName)
+}
+
+func (svr *Server) lookup(sName string, mName string) (*Service, *Method, bool) {
+	s, ok := svr.Sm.Load(sName)
+	if !ok && svr.Naming == NamingDefault {
+		s, ok = svr.Sm.Load(lineToHump(sName)) // 支持大驼峰、小驼峰、下划线
+	}
+	if !ok {
+		return nil, nil, false
+	}
+	svc := s.(*Service)
+	m, ok := svc.Mm[mName]
+	if !ok && svr.Naming == NamingDefault {
+		m, ok = svc.Mm[lineToHump(mName)]
+	}
+	return svc, m, ok
+}
+
+// RegisterMethods 注册方法，返回可注册的方法与签名错误的导出方法
+func RegisterMethods(s reflect.Type) (map[string]*Method, []*MethodError) {
 	mm := make(map[string]*Method, 0) // 初始化对象
+	var skipped []*MethodError
 	// s.NumMethod 获取方法数量
 	for m := 0; m < s.NumMethod(); m++ {
 		// s.Method(m) 循环遍历方法
 		rm := s.Method(m)
 		// 具体注册
-		if mt := RegisterMethod(rm); mt != nil {
-			mm[rm.Name] = mt
+		mt, err := RegisterMethod(rm)
+		if err != nil {
+			skipped = append(skipped, err)
+			continue
 		}
+		mm[rm.Name] = mt
 	}
-	return mm
+	return mm, skipped
 }
 
-func RegisterMethod(rm reflect.Method) *Method {
-	var msg string
-	rmt := rm.Type // 获取类型
-	rmn := rm.Name // 获取名称
+func RegisterMethod(rm reflect.Method) (*Method, *MethodError) {
+	// 方法的第一个参数为接收者
+	m, err := newMethod(rm.Name, rm.Type, 1)
+	if err != nil {
+		return nil, err
+	}
+	m.Method = rm
+	m.Func = rm.Func
+	m.Receiver = true
+	return m, nil
+}
+
+// RegisterFunc 校验函数签名并生成方法，支持 func(*P, *R) error 与 func(context.Context, *P, *R) error
+func RegisterFunc(name string, fn interface{}) (*Method, *MethodError) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return nil, &MethodError{Method: name, Reason: fmt.Sprintf("不是函数类型 %T", fn)}
+	}
+	m, err := newMethod(name, fv.Type(), 0)
+	if err != nil {
+		return nil, err
+	}
+	m.Func = fv
+	return m, nil
+}
+
+// newMethod 校验签名，skip 为签名中需要跳过的参数个数
+func newMethod(rmn string, rmt reflect.Type, skip int) (*Method, *MethodError) {
+	// 第一个参数为 context.Context 时调用会传入请求上下文
+	withContext := rmt.NumIn() > skip && rmt.In(skip) == contextType
+	if withContext {
+		skip++
+	}
 	// rm.NumIn 返回参数个数
-	if rmt.NumIn() != 3 {
-		msg = fmt.Sprintf("RegisterMethod：注册方法 %q 需要 %d 个参数", rmn, rmt.NumIn())
-		Debug(msg)
-		return nil
+	if rmt.NumIn()-skip != 2 {
+		return nil, &MethodError{Method: rmn, Reason: fmt.Sprintf("需要 2 个参数，实际为 %d 个", rmt.NumIn()-skip)}
 	}
-	p := rmt.In(1) // 返回func类型的第i个参数的类型，如非函数或者i不在[0, NumIn())内将会panic
-	// 判断第一个参数类型是否为指针类型
-	if p.Kind() != reflect.Ptr {
-		msg = fmt.Sprintf("RegisterMethod: 注册方法 %q的结果类型不是指针类型 %q", rmn, p)
-		Debug(msg)
-		return nil
+	p := rmt.In(skip) // 返回func类型的第i个参数的类型，如非函数或者i不在[0, NumIn())内将会panic
+	// 参数可以是结构体、基础类型、切片、map 等任意可以由 json 解析的类型，指针与非指针均可
+	if !jsonKind(p) {
+		return nil, &MethodError{Method: rmn, Reason: fmt.Sprintf("参数类型无法由 json 解析 %s", p)}
 	}
 
-	r := rmt.In(2) // 返回func类型的第i个参数的类型，如非函数或者i不在[0, NumIn())内将会panic
+	r := rmt.In(skip + 1) // 返回func类型的第i个参数的类型，如非函数或者i不在[0, NumIn())内将会panic
+	// 第二个参数为 *Stream 时注册为流式方法
+	stream := r == StreamType
 
 	// Kind返回该接口的具体分类 不等于该指针
 	if r.Kind() != reflect.Ptr {
-		msg = fmt.Sprintf("RegisterMethod：注册方法 %q 的结果类型不是指针类型：%q", rmn, r)
-		Debug(msg)
-		return nil
+		return nil, &MethodError{Method: rmn, Reason: fmt.Sprintf("结果类型不是指针类型 %s", r)}
+	}
+	if !jsonKind(r.Elem()) {
+		return nil, &MethodError{Method: rmn, Reason: fmt.Sprintf("结果类型无法转换为 json %s", r)}
 	}
 
 	// 检测函数的返回参数个数
 	if rmt.NumOut() != 1 {
-		msg = fmt.Sprintf("RegisterMethod: 注册方法 %q 返回参数个数不是一个 %q", rmn, rmt.NumOut())
-		Debug(msg)
-		return nil
+		return nil, &MethodError{Method: rmn, Reason: fmt.Sprintf("返回参数个数不是一个 %d", rmt.NumOut())}
 	}
 
 	// 返回func类型的第i个返回值的类型，如非函数或者i不在[0, NumOut())内将会panic
 	ret := rmt.Out(0)
 	// 判断返回参数的类型是否为nil
 	if ret != reflect.TypeOf((*error)(nil)).Elem() {
-		msg = fmt.Sprintf("RegisterMethod：注册方法 %q 的返回参数错误 %q", rmn, ret)
-		Debug(msg)
-		return nil
+		return nil, &MethodError{Method: rmn, Reason: fmt.Sprintf("返回参数不是 error 类型 %s", ret)}
 	}
 
 	// 进行方法绑定
@@ -142,71 +392,262 @@ func RegisterMethod(rm reflect.Method) *Method {
 		Name:       rmn,
 		ParamsType: p,
 		ResultType: r,
-		Method:     rm,
+		Context:    withContext,
+		Validate:   hasValidTags(p, make(map[reflect.Type]bool)),
+		Stream:     stream,
 	}
-	return m
+	return m, nil
 }
 
-func (svr *Server) SingleHandler(jsonMap map[string]interface{}) interface{} {
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 
-	id, jsonRpc, method, paramsData, errCode := ParseSingleRequestBody(jsonMap)
-	if errCode != WithoutError {
-		return E(id, jsonRpc, errCode)
+// indirectParams 参数声明为指针时返回指向的类型
+func indirectParams(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// jsonKind 检测类型是否可以与 json 相互转换
+func jsonKind(t reflect.Type) bool {
+	switch indirectType(t).Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return false
+	}
+	return true
+}
+
+// Call 调用方法，recv 为服务实例，注册的函数不需要接收者
+func (m *Method) Call(ctx context.Context, recv reflect.Value, params reflect.Value, result reflect.Value) error {
+	in := make([]reflect.Value, 0, 4)
+	if m.Receiver {
+		in = append(in, recv)
+	}
+	if m.Context {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	// 参数声明为非指针类型时传入值
+	if m.ParamsType.Kind() != reflect.Ptr {
+		params = params.Elem()
 	}
+	in = append(in, params, result)
+	// Call 输入参数 in 并调用函数 v
+	if i := m.Func.Call(in)[0].Interface(); i != nil {
+		return i.(error)
+	}
+	return nil
+}
+
+// SingleHandler 处理单个 json 请求，开启指标与访问日志时记录请求数、错误数与耗时
+func (svr *Server) SingleHandler(ctx context.Context, b json.RawMessage) interface{} {
+	return svr.handleSingle(ctx, nil, b)
+}
 
-	if svr.RateLimiter != nil && !svr.RateLimiter.Allow() {
-		return CE(id, jsonRpc, "请求次数过多，请稍候在试")
+// handleSingle 按编码处理单个请求，c 为 nil 时为 json
+func (svr *Server) handleSingle(ctx context.Context, c RawCodec, b []byte) interface{} {
+	sm, lo := svr.Metrics(), svr.logOptions()
+	if lo != nil && !lo.AccessLog {
+		lo = nil
+	}
+	info := &callInfo{name: UnknownMethod, req: &RawRequest{}, ctx: ctx}
+	if sm == nil && lo == nil {
+		return svr.singleHandler(ctx, c, b, info)
+	}
+	start := time.Now()
+	if sm != nil {
+		sm.InFlight.Add(1)
+	}
+	res := svr.singleHandler(ctx, c, b, info)
+	d := time.Since(start)
+	if sm != nil {
+		sm.InFlight.Add(-1)
+		sm.observe(info.name, res, d)
+	}
+	if lo != nil {
+		svr.accessLog(lo, info, res, d)
 	}
+	return res
+}
+
+// callInfo 单个请求的处理信息，供指标与访问日志使用
+type callInfo struct {
+	name   string          // 指标使用的方法名
+	req    *RawRequest     // 解析后的请求
+	method *Method         // 请求的方法，不存在时为 nil
+	ctx    context.Context // 携带调用方身份与 span 的上下文
+}
 
-	// 检测解析请求方法是否正确
-	sName, mName, err := ParseRequestMethod(method)
+// singleHandler 处理单个请求，info 返回请求的处理信息
+func (svr *Server) singleHandler(ctx context.Context, c RawCodec, b []byte, info *callInfo) (res interface{}) {
+	var (
+		req     *RawRequest
+		errCode int
+	)
+	if c == nil || IsJSON(c) {
+		req, errCode = ParseRawRequest(b)
+	} else {
+		req, errCode = parseCodecRequest(c, b)
+	}
+	id, jsonRpc, method := req.responseId(), req.JsonRpc, req.Method
+	info.req = req
+	if errCode != WithoutError {
+		return E(id, JsonRpc, errCode)
+	}
+
+	// 查找请求的服务与方法，限流规则按注册的服务名与方法名分组
+	svc, m, ok := svr.Lookup(method)
+	info.name, info.method = metricMethod(method, svc, m), m
+	defer func() {
+		info.ctx = ctx
+	}()
+	// 开启链路追踪时以请求携带的 trace context 为父节点创建服务端 span，方法通过 ctx 创建子 span
+	if t := svr.Tracing(); t != nil {
+		var span trace.Span
+		ctx, span = t.startServer(ctx, req, info.name, svc, m)
+		defer func() {
+			endServer(span, res)
+		}()
+	}
+	peer := PeerFromContext(ctx)
+	if peer != nil {
+		peer.handle()
+	}
+	// 校验请求签名，签名的密钥标识在没有其它认证信息时作为调用方身份
+	signer, err := svr.verifySign(ctx, req)
 	if err != nil {
-		return E(id, JsonRpc, MethodNotFound)
+		if peer != nil {
+			peer.reject(Unauthorized, 0)
+		}
+		return ED(id, jsonRpc, Unauthorized, err.Error())
 	}
-	// 读取 Map 中的方法
-	s, ok := svr.Sm.Load(sName)
-	if !ok {
-		sName = lineToHump(sName) // 支持大驼峰、小驼峰、下划线
-		s, ok = svr.Sm.Load(sName)
-		if !ok {
-			return E(id, jsonRpc,
-				MethodNotFound)
+	if signer != nil {
+		ctx = WithPrincipal(ctx, signer)
+	}
+	// 认证调用方，认证后的身份通过上下文传递给方法与限流规则
+	principal, err := svr.authenticate(ctx, req, svc, m)
+	if err != nil {
+		if peer != nil {
+			peer.reject(Unauthorized, 0)
 		}
+		return ED(id, jsonRpc, Unauthorized, err.Error())
+	}
+	if principal != nil {
+		ctx = WithPrincipal(ctx, principal)
 	}
-	// 断言 s 对象是否为 Service 的实例
-	m, ok := s.(*Service).Mm[mName]
+	if allowed, delay := svr.rateLimit(ctx, svc, m); !allowed {
+		if peer != nil {
+			peer.reject(RateLimited, delay)
+		}
+		return rateLimited(id, jsonRpc, delay)
+	}
+
+	// tcp 连接的认证握手
+	if method == AuthMethod {
+		p, err := svr.authHandshake(ctx, req)
+		if err != nil {
+			return ED(id, jsonRpc, Unauthorized, err.Error())
+		}
+		return S(id, jsonRpc, p)
+	}
+
+	// 按访问控制规则检测调用方的权限，方法不存在时之后返回 MethodNotFound
+	if ok || isBuiltin(method) {
+		full := method
+		if ok {
+			full = svc.Name + "." + m.Name
+		}
+		if !svr.authorize(ctx, full) {
+			if peer != nil {
+				peer.reject(Forbidden, 0)
+			}
+			return E(id, jsonRpc, Forbidden)
+		}
+	}
+
+	// 内置方法：服务发现返回 OpenRPC 文档，存活检测与健康检查
+	switch method {
+	case DiscoverMethod:
+		return S(id, jsonRpc, svr.Discover())
+	case PingMethod:
+		return S(id, jsonRpc, "pong")
+	case HealthMethod:
+		return S(id, jsonRpc, svr.Health(ctx))
+	}
+
 	if !ok {
 		return E(id, jsonRpc, MethodNotFound)
 	}
 
 	// 获取值类型并把所有属性的值分配零值
-	params := reflect.New(m.ParamsType.Elem())
+	params := reflect.New(indirectParams(m.ParamsType))
 	pv := params.Interface() // 返回 interface 的 value 值
-	// 转换
-	err = gconv.Struct(paramsData, pv)
+	// 按 json 标签绑定参数，失败时在 data 中返回每个字段的错误，json.RawMessage 类型的参数保持原样
+	err = req.decodeParams(pv, svr.StrictParams)
 	if err != nil {
+		if be, ok := err.(*BindError); ok {
+			return ED(id, jsonRpc, InvalidParams, be.Errors)
+		}
 		return E(id, jsonRpc, InvalidParams)
 	}
+	// 按 v 标签校验参数
+	if m.Validate {
+		if err = ValidateParams(ctx, pv); err != nil {
+			return ED(id, jsonRpc, InvalidParams, err.(*BindError).Errors)
+		}
+	}
+	// 流式方法需要 id 关联分片，并且只能在支持推送的连接上调用
+	var stream *Stream
+	if m.Stream {
+		if id == nil {
+			return E(id, jsonRpc, InvalidRequest)
+		}
+		send := SenderFromContext(ctx)
+		if send == nil {
+			return CE(id, jsonRpc, "流式方法仅支持 tcp 协议调用")
+		}
+		stream = NewStream(req.Id.(string), send)
+		stream.codec = req.Codec
+	}
+
+	// 超过并发限制并且排队失败时快速拒绝
+	release, ok := svr.acquire(ctx, svc, m)
+	if !ok {
+		if peer != nil {
+			peer.reject(Overloaded, 0)
+		}
+		return E(id, jsonRpc, Overloaded)
+	}
+	defer release()
+
 	// 获取返回参数的值并分配零值
-	result := reflect.New(m.ResultType.Elem())
+	var result reflect.Value
+	if stream != nil {
+		result = reflect.ValueOf(stream)
+	} else {
+		result = reflect.New(m.ResultType.Elem())
+	}
 
 	// 检测是否开启了 before 操作  启动前的操作
 	if svr.Hooks.BeforeFunc != nil {
-		err = svr.Hooks.BeforeFunc(id, method, params.Elem().Interface())
+		err = svr.Hooks.BeforeFunc(req.Id, method, params.Elem().Interface())
 		if err != nil {
 			return CE(id, jsonRpc, err.Error())
 		}
 	}
-	// Call 输入参数 in 并调用函数 v
-	r := m.Method.Func.Call([]reflect.Value{s.(*Service).V, params, result})
-	if i := r[0].Interface(); i != nil {
-		Debug(i.(error))
+	if err = m.Call(ctx, svc.V, params, result); err != nil {
+		DebugContext(ctx, err)
 		return E(id, jsonRpc, InternalError)
 	}
 
+	// 流式方法以分片数量作为最终响应，标记推送结束
+	if stream != nil {
+		result = reflect.ValueOf(&StreamEnd{Done: true, Count: stream.Count()})
+	}
+
 	// 检测是否开启了 after 操作， 启动完成后的操作
 	if svr.Hooks.AfterFunc != nil {
-		err = svr.Hooks.AfterFunc(id, method, result.Elem().Interface())
+		err = svr.Hooks.AfterFunc(req.Id, method, result.Elem().Interface())
 		if err != nil {
 			return CE(id, jsonRpc, err.Error())
 		}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type helperService struct{}
+
+func (helperService) Add(args *benchArgs, result *int) error {
+	*result = args.A + args.B
+	return nil
+}
+
+// Helper 导出的辅助方法，签名不符合要求
+func (helperService) Helper() string {
+	return "helper"
+}
+
+func TestRegisterLenientSkipsMethods(t *testing.T) {
+	l := &memoryLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	svr := &Server{}
+	if err := svr.RegisterName("calc", helperService{}); err != nil {
+		t.Fatalf("lenient register: %v", err)
+	}
+	svc, m, ok := svr.Lookup("calc.add")
+	if !ok || m == nil {
+		t.Fatal("calc.add not registered")
+	}
+	if len(svc.Skipped) != 1 || svc.Skipped[0].Method != "Helper" {
+		t.Errorf("skipped %v, want Helper", svc.Skipped)
+	}
+	if len(l.entries) != 1 || l.entries[0].level != LevelWarn || l.field("method") != "Helper" {
+		t.Errorf("log entries %+v", l.entries)
+	}
+}
+
+func TestRegisterStrictRejectsService(t *testing.T) {
+	svr := &Server{Strict: true}
+	err := svr.RegisterName("calc", helperService{})
+	var re *RegisterError
+	if !errors.As(err, &re) || len(re.Methods) != 1 {
+		t.Fatalf("strict register: %v", err)
+	}
+	if _, _, ok := svr.Lookup("calc.add"); ok {
+		t.Error("service registered in strict mode")
+	}
+}
+
+type calcV2 struct{}
+
+func (calcV2) Add(args *benchArgs, result *int) error {
+	*result = args.A + args.B + 1
+	return nil
+}
+
+func (calcV2) Sub(args *benchArgs, result *int) error {
+	*result = args.A - args.B
+	return nil
+}
+
+func TestRegisterFuncNaming(t *testing.T) {
+	svr := &Server{Naming: NamingSnake}
+	if err := svr.Register(helperService{}); err != nil {
+		t.Fatal(err)
+	}
+	mul := func(args *benchArgs, result *int) error {
+		*result = args.A * args.B
+		return nil
+	}
+	if err := svr.RegisterFunc("HelperService.MulAll", mul); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := svr.Lookup("helper_service.mul_all"); !ok {
+		t.Error("helper_service.mul_all not registered")
+	}
+	if _, _, ok := svr.Lookup("helper_service.add"); !ok {
+		t.Error("function registration dropped the service methods")
+	}
+	if err := svr.RegisterFunc("helper_service.mul_all", mul); err == nil {
+		t.Error("registered the same function twice")
+	}
+}
+
+func TestReplaceKeepsFuncs(t *testing.T) {
+	svr := &Server{}
+	if err := svr.RegisterName("calc", helperService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.RegisterFunc("calc.Mul", func(args *benchArgs, result *int) error {
+		*result = args.A * args.B
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.RegisterFunc("calc.Sub", func(args *benchArgs, result *int) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.Replace("calc", calcV2{}); err != nil {
+		t.Fatal(err)
+	}
+	for method, want := range map[string]int{"calc.add": 8, "calc.mul": 10, "calc.sub": 3} {
+		res := svr.HandlerContext(context.Background(), []byte(`{"jsonrpc":"2.0","id":"1","method":"`+method+`","params":{"a":5,"b":2}}`))
+		var r struct {
+			Result int `json:"result"`
+		}
+		if err := json.Unmarshal(res, &r); err != nil || r.Result != want {
+			t.Errorf("%s = %s, want %d", method, res, want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signature 请求签名，作为请求的 sign 字段传递
+//
+//	{"jsonrpc": "2.0", "id": "1", "method": "user/info", "params": {"id": 1},
+//	 "sign": {"key": "app1", "timestamp": 1700000000, "nonce": "5f2b9c", "signature": "..."}}
+type Signature struct {
+	Key       string `json:"key"`       // 密钥标识
+	Timestamp int64  `json:"timestamp"` // 签名时的秒级时间戳
+	Nonce     string `json:"nonce"`     // 随机字符串，有效期内不能重复使用
+	Signature string `json:"signature"` // hex(HMAC-SHA256(secret, timestamp + "\n" + nonce + "\n" + method + "\n" + 规范化的 params))，与 HMAC 认证的算法相同
+}
+
+// 签名错误
+var (
+	ErrSignMissing  = errors.New("rpc: 请求未签名")
+	ErrSignExpired  = errors.New("rpc: 签名已过期")
+	ErrSignReplayed = errors.New("rpc: 签名已使用")
+	ErrSignInvalid  = errors.New("rpc: 签名错误")
+)
+
+// CanonicalParams 返回签名使用的规范化 params，未传递参数时为空，规则如下：
+//   - 对象的键按 utf-8 字节序排列，对应 php 的 ksort($v, SORT_STRING)，去掉所有空白
+//   - 数字、true、false、null 以及空对象 {} 与空数组 [] 保持请求中的原始写法
+//   - 字符串只转义引号、反斜杠与控制字符，\b \f \n \r \t 使用简写，其它控制字符与 U+2028、U+2029 使用小写的 \uxxxx 形式，
+//     不转义斜杠、非 ascii 字符与 < > &，与 php 的 JSON_UNESCAPED_UNICODE | JSON_UNESCAPED_SLASHES 一致
+//
+// 数字保持原始写法，签名方需要对实际发送的 params 计算签名，而不是重新编码后的结果
+func CanonicalParams(params json.RawMessage) ([]byte, error) {
+	if isNull(params) {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeCanonical(&buf, v)
+	return buf.Bytes(), nil
+}
+
+// writeCanonical 按规范化规则输出 json，不依赖 encoding/json 的转义规则，避免不同 Go 版本的输出不一致
+func writeCanonical(buf *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			writeCanonical(buf, x[k])
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonical(buf, item)
+		}
+		buf.WriteByte(']')
+	case string:
+		writeCanonicalString(buf, x)
+	case json.Number:
+		buf.WriteString(x.String())
+	case bool:
+		buf.WriteString(strconv.FormatBool(x))
+	case nil:
+		buf.WriteString("null")
+	}
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const digits = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\u2028', '\u2029':
+			buf.WriteString(`\u202`)
+			buf.WriteByte(digits[r&0xf])
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(digits[r>>4])
+				buf.WriteByte(digits[r&0xf])
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// SignatureOf 计算单个请求的签名，与 HMAC 认证使用相同的算法，签名内容为 method + "\n" + 规范化的 params
+func SignatureOf(secret string, timestamp int64, nonce string, method string, params json.RawMessage) (string, error) {
+	canonical, err := CanonicalParams(params)
+	if err != nil {
+		return "", err
+	}
+	return HMACSignature(secret, strconv.FormatInt(timestamp, 10), nonce, authPayload(method, canonical)), nil
+}
+
+// Signer 客户端签名器，为请求体中的每个请求添加 sign 字段
+type Signer struct {
+	Key    string // 密钥标识
+	Secret string // 密钥
+}
+
+// Sign 生成单个请求的签名
+func (s *Signer) Sign(method string, params json.RawMessage) (*Signature, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sig := &Signature{Key: s.Key, Timestamp: time.Now().Unix(), Nonce: hex.EncodeToString(nonce)}
+	var err error
+	sig.Signature, err = SignatureOf(s.Secret, sig.Timestamp, sig.Nonce, method, params)
+	return sig, err
+}
+
+// signParams 按 params 的 json 格式签名，与服务端转换后的 params 一致
+func (s *Signer) signParams(method string, params interface{}) (*Signature, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(method, raw)
+}
+
+// SignBody 为请求体中的每个请求签名，支持批量请求
+func (s *Signer) SignBody(b []byte) ([]byte, error) {
+	list, batch, err := SplitBatch(b)
+	if err != nil {
+		return nil, err
+	}
+	for i, raw := range list {
+		var req map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &req); err != nil {
+			return nil, err
+		}
+		var method string
+		_ = json.Unmarshal(req["method"], &method)
+		sig, err := s.Sign(method, req["params"])
+		if err != nil {
+			return nil, err
+		}
+		req["sign"], _ = json.Marshal(sig)
+		if list[i], err = json.Marshal(req); err != nil {
+			return nil, err
+		}
+	}
+	if batch {
+		return json.Marshal(list)
+	}
+	return list[0], nil
+}
+
+// NonceStore 记录已使用的 nonce，用于防止重放
+type NonceStore interface {
+	// Use 记录 nonce，在 ttl 内已经使用过时返回 false
+	Use(key string, nonce string, ttl time.Duration) bool
+}
+
+// verifyHMAC 校验时间戳偏差、签名与 nonce，请求签名与 HMAC 认证共用
+// 签名校验通过后再记录 nonce，避免伪造的请求占用 nonce；时间戳超出偏差的请求已被拒绝，nonce 只需保留两倍偏差
+func verifyHMAC(secret string, keyId string, timestamp string, nonce string, signature string, payload []byte, maxSkew time.Duration, nonces NonceStore) error {
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return ErrSignInvalid
+	}
+	if d := time.Since(time.Unix(t, 0)); d > maxSkew || d < -maxSkew {
+		return ErrSignExpired
+	}
+	expect := HMACSignature(secret, timestamp, nonce, payload)
+	if !hmac.Equal([]byte(expect), []byte(strings.ToLower(signature))) {
+		return ErrSignInvalid
+	}
+	if !nonces.Use(keyId, nonce, 2*maxSkew) {
+		return ErrSignReplayed
+	}
+	return nil
+}
+
+// NewMemoryNonceStore 创建基于内存的 nonce 存储，过期的 nonce 定期清理
+// 多实例部署时需要实现基于 redis 等共享存储的 NonceStore
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func (s *memoryNonceStore) Use(key string, nonce string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, expire := range s.nonces {
+			if now.After(expire) {
+				delete(s.nonces, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	k := key + "\n" + nonce
+	if expire, ok := s.nonces[k]; ok && now.Before(expire) {
+		return false
+	}
+	s.nonces[k] = now.Add(ttl)
+	return true
+}
+
+// SignOptions 签名校验配置
+type SignOptions struct {
+	Secret   func(ctx context.Context, key string) (string, error) // 按密钥标识返回密钥
+	MaxSkew  time.Duration                                         // 允许的时钟偏差，为 0 时为 5 分钟
+	Nonces   NonceStore                                            // nonce 存储，为 nil 时使用内存存储
+	Required bool                                                  // 拒绝未签名的请求，否则只校验携带了签名的请求
+}
+
+// SetSign 开启请求签名校验，校验通过的请求在没有其它认证信息时以密钥标识作为调用方身份
+func (svr *Server) SetSign(o SignOptions) {
+	if o.MaxSkew <= 0 {
+		o.MaxSkew = 5 * time.Minute
+	}
+	if o.Nonces == nil {
+		o.Nonces = NewMemoryNonceStore()
+	}
+	svr.sign.Store(&o)
+}
+
+// verifySign 校验请求签名，返回签名对应的调用方身份，未开启或未签名时返回 nil
+func (svr *Server) verifySign(ctx context.Context, req *RawRequest) (*Principal, error) {
+	o, _ := svr.sign.Load().(*SignOptions)
+	if o == nil {
+		return nil, nil
+	}
+	sig := req.Sign
+	if sig == nil {
+		if o.Required {
+			return nil, ErrSignMissing
+		}
+		return nil, nil
+	}
+	if sig.Key == "" || sig.Nonce == "" || sig.Signature == "" {
+		return nil, ErrSignInvalid
+	}
+	secret, err := o.Secret(ctx, sig.Key)
+	if err != nil {
+		return nil, err
+	}
+	params, err := req.jsonParams()
+	if err != nil {
+		return nil, ErrSignInvalid
+	}
+	canonical, err := CanonicalParams(params)
+	if err != nil {
+		return nil, ErrSignInvalid
+	}
+	ts := strconv.FormatInt(sig.Timestamp, 10)
+	if err = verifyHMAC(secret, sig.Key, ts, sig.Nonce, sig.Signature, authPayload(req.Method, canonical), o.MaxSkew, o.Nonces); err != nil {
+		return nil, err
+	}
+	return &Principal{Id: sig.Key}, nil
+}
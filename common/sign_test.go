@@ -0,0 +1,201 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCanonicalParams(t *testing.T) {
+	cases := map[string]string{
+		`null`:                                   ``,
+		`{"b":1.50,"a":{}}`:                      `{"a":{},"b":1.50}`,
+		`{ "b" : [3, {"z":1,"y":[]}], "a":1e3 }`: `{"a":1e3,"b":[3,{"y":[],"z":1}]}`,
+		`{"B":1,"a":2,"10":3,"9":4}`:             `{"10":3,"9":4,"B":1,"a":2}`,
+		`["a/b","<&>","中文"]`:                     `["a/b","<&>","中文"]`,
+		`["\"\\\b\f\n\r\t\u0001\u001f "]`:        `["\"\\\b\f\n\r\t\u0001\u001f\u2028"]`,
+		`[true,false,null,-0.0]`:                 `[true,false,null,-0.0]`,
+	}
+	for in, want := range cases {
+		got, err := CanonicalParams(json.RawMessage(in))
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+	if _, err := CanonicalParams(json.RawMessage(`{bad`)); err == nil {
+		t.Error("invalid json accepted")
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	s := NewMemoryNonceStore()
+	if !s.Use("app1", "n1", time.Minute) {
+		t.Fatal("first use rejected")
+	}
+	if s.Use("app1", "n1", time.Minute) {
+		t.Error("replayed nonce accepted")
+	}
+	if !s.Use("app2", "n1", time.Minute) {
+		t.Error("nonce should be scoped by key")
+	}
+	if !s.Use("app1", "n2", -time.Second) || !s.Use("app1", "n2", time.Minute) {
+		t.Error("expired nonce should be reusable")
+	}
+}
+
+func newSignServer(required bool) *Server {
+	svr := &Server{}
+	svr.SetSign(SignOptions{
+		Secret: func(ctx context.Context, key string) (string, error) {
+			return "s3cret-" + key, nil
+		},
+		MaxSkew:  time.Minute,
+		Required: required,
+	})
+	return svr
+}
+
+func signedRequest(t *testing.T, sig *Signature, method string, params string) *RawRequest {
+	t.Helper()
+	b, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": "1", "method": method, "params": json.RawMessage(params), "sign": sig})
+	req, code := ParseRawRequest(b)
+	if code != WithoutError {
+		t.Fatalf("parse %s: %d", b, code)
+	}
+	return req
+}
+
+func TestVerifySign(t *testing.T) {
+	svr := newSignServer(true)
+	ctx := context.Background()
+	signer := &Signer{Key: "app1", Secret: "s3cret-app1"}
+	params := `{"name":"中文","amount":1.50,"tags":{}}`
+
+	sig, err := signer.Sign("order.create", json.RawMessage(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := svr.verifySign(ctx, signedRequest(t, sig, "order.create", params))
+	if err != nil || p == nil || p.Id != "app1" {
+		t.Fatalf("valid signature: %v %v", p, err)
+	}
+	// 同一个 nonce 不能重复使用
+	if _, err = svr.verifySign(ctx, signedRequest(t, sig, "order.create", params)); err != ErrSignReplayed {
+		t.Errorf("replay: got %v, want %v", err, ErrSignReplayed)
+	}
+	// 键的顺序与空白不影响签名
+	sig, _ = signer.Sign("order.create", json.RawMessage(params))
+	if _, err = svr.verifySign(ctx, signedRequest(t, sig, "order.create", `{ "tags":{}, "amount":1.50, "name":"中文" }`)); err != nil {
+		t.Errorf("reordered params: %v", err)
+	}
+	// 篡改参数或方法
+	sig, _ = signer.Sign("order.create", json.RawMessage(params))
+	if _, err = svr.verifySign(ctx, signedRequest(t, sig, "order.create", `{"name":"中文","amount":1.5,"tags":{}}`)); err != ErrSignInvalid {
+		t.Errorf("tampered params: got %v, want %v", err, ErrSignInvalid)
+	}
+	if _, err = svr.verifySign(ctx, signedRequest(t, sig, "order.delete", params)); err != ErrSignInvalid {
+		t.Errorf("tampered method: got %v, want %v", err, ErrSignInvalid)
+	}
+	// 签名错误的请求不占用 nonce
+	if _, err = svr.verifySign(ctx, signedRequest(t, sig, "order.create", params)); err != nil {
+		t.Errorf("nonce consumed by rejected request: %v", err)
+	}
+	// 时间戳超出允许的偏差
+	for _, skew := range []time.Duration{-2 * time.Minute, 2 * time.Minute} {
+		sig = &Signature{Key: "app1", Timestamp: time.Now().Add(skew).Unix(), Nonce: "skew" + skew.String()}
+		sig.Signature, _ = SignatureOf("s3cret-app1", sig.Timestamp, sig.Nonce, "order.create", json.RawMessage(params))
+		if _, err = svr.verifySign(ctx, signedRequest(t, sig, "order.create", params)); err != ErrSignExpired {
+			t.Errorf("skew %s: got %v, want %v", skew, err, ErrSignExpired)
+		}
+	}
+	if _, err = svr.verifySign(ctx, signedRequest(t, nil, "order.create", params)); err != ErrSignMissing {
+		t.Errorf("unsigned: got %v, want %v", err, ErrSignMissing)
+	}
+	if p, err = newSignServer(false).verifySign(ctx, signedRequest(t, nil, "order.create", params)); p != nil || err != nil {
+		t.Errorf("unsigned optional: got %v %v", p, err)
+	}
+}
+
+func TestSignBodyBatch(t *testing.T) {
+	svr := newSignServer(true)
+	signer := &Signer{Key: "app1", Secret: "s3cret-app1"}
+	b, err := signer.SignBody([]byte(`[{"jsonrpc":"2.0","id":"1","method":"a.b","params":[1]},{"jsonrpc":"2.0","method":"a.c"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, batch, err := SplitBatch(b)
+	if err != nil || !batch || len(list) != 2 {
+		t.Fatalf("split: %v %v %d", err, batch, len(list))
+	}
+	for _, raw := range list {
+		req, _ := ParseRawRequest(raw)
+		if _, err = svr.verifySign(context.Background(), req); err != nil {
+			t.Errorf("%s: %v", raw, err)
+		}
+	}
+}
+
+func TestHMACAuthSharesSignFormat(t *testing.T) {
+	a := HMACAuth(func(ctx context.Context, keyId string) (string, *Principal, error) {
+		return "s3cret", &Principal{Id: keyId}, nil
+	}, time.Minute, nil)
+	ctx := context.Background()
+	body := []byte(`{"jsonrpc":"2.0","id":"1","method":"a.b"}`)
+
+	c, err := ParseCredentials(HMACCredentials("app1", "s3cret", body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Payload = body
+	if p, err := a.Authenticate(ctx, c); err != nil || p.Id != "app1" {
+		t.Fatalf("valid credentials: %v %v", p, err)
+	}
+	if _, err = a.Authenticate(ctx, c); err != ErrSignReplayed {
+		t.Errorf("replay: got %v, want %v", err, ErrSignReplayed)
+	}
+	c.Payload = []byte("tampered")
+	if _, err = a.Authenticate(ctx, c); err != ErrSignInvalid {
+		t.Errorf("tampered: got %v, want %v", err, ErrSignInvalid)
+	}
+	delete(c.Params, "nonce")
+	if _, err = a.Authenticate(ctx, c); err != ErrBadCredentials {
+		t.Errorf("missing nonce: got %v, want %v", err, ErrBadCredentials)
+	}
+
+	// auth 字段的签名与 sign 字段的签名相同
+	ts := time.Now().Unix()
+	params := json.RawMessage(`{"b":2,"a":1}`)
+	sig, _ := SignatureOf("s3cret", ts, "n1", "a.b", params)
+	canonical, _ := CanonicalParams(params)
+	if HMACSignature("s3cret", strconv.FormatInt(ts, 10), "n1", authPayload("a.b", canonical)) != sig {
+		t.Error("auth field and sign field use different signatures")
+	}
+}
+
+// 请求级别的 sign 字段优先于连接级别的认证信息
+func TestAuthenticatePrecedence(t *testing.T) {
+	svr := &Server{}
+	svr.SetAuth(AuthOptions{Authenticators: []Authenticator{
+		APIKeyAuth(map[string]*Principal{"k1": {Id: "api"}, "k2": {Id: "field"}}),
+	}})
+	peer := &Peer{Transport: "http", Principal: &Principal{Id: "header"}}
+	ctx := WithPeer(context.Background(), peer)
+	req := &RawRequest{Method: "a.b"}
+
+	if p, _ := svr.authenticate(ctx, req, nil, nil); p == nil || p.Id != "header" {
+		t.Errorf("connection credentials: got %v", p)
+	}
+	signed := WithPrincipal(ctx, &Principal{Id: "app1"})
+	if p, _ := svr.authenticate(signed, req, nil, nil); p == nil || p.Id != "app1" {
+		t.Errorf("sign field: got %v, want app1", p)
+	}
+	req.Auth = "ApiKey k2"
+	if p, _ := svr.authenticate(signed, req, nil, nil); p == nil || p.Id != "field" {
+		t.Errorf("auth field: got %v, want field", p)
+	}
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// StreamMethod 流式分片通知使用的方法名
+const StreamMethod = "rpc.stream"
+
+// StreamType 流式方法第二个参数的类型
+var StreamType = reflect.TypeOf((*Stream)(nil))
+
+// Sender 向当前连接写入一个完整的消息，消息的编码与请求一致
+type Sender func(b []byte) error
+
+type senderKey struct{}
+
+// WithSender 将连接的写入函数放入上下文，只有支持推送的协议才会设置
+func WithSender(ctx context.Context, send Sender) context.Context {
+	return context.WithValue(ctx, senderKey{}, send)
+}
+
+// SenderFromContext 获取上下文中的写入函数
+func SenderFromContext(ctx context.Context) Sender {
+	send, _ := ctx.Value(senderKey{}).(Sender)
+	return send
+}
+
+// StreamChunk 流式分片通知的参数
+type StreamChunk struct {
+	Id    string      `json:"id"`
+	Index int         `json:"index"`
+	Data  interface{} `json:"data"`
+}
+
+// StreamEnd 流式方法结束时最终响应的结果
+type StreamEnd struct {
+	Done  bool `json:"done"`
+	Count int  `json:"count"`
+}
+
+// Stream 流式方法的结果发送器
+// 每次 Send 都会以 rpc.stream 通知的形式推送一个分片，并通过 id 与原请求关联
+type Stream struct {
+	mu    sync.Mutex
+	id    string
+	count int
+	send  Sender
+	codec RawCodec // 分片使用请求的编码，为 nil 时为 json
+}
+
+// NewStream 创建流式发送器
+func NewStream(id string, send Sender) *Stream {
+	return &Stream{id: id, send: send}
+}
+
+// Send 推送一个结果分片
+func (s *Stream) Send(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.send == nil {
+		return errors.New("rpc: 当前连接不支持流式推送")
+	}
+	b, err := Encode(s.codec, NotifyRequest{
+		JsonRpc: JsonRpc,
+		Method:  StreamMethod,
+		Params:  StreamChunk{Id: s.id, Index: s.count, Data: v},
+	})
+	if err != nil {
+		return err
+	}
+	if err = s.send(b); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// Count 已推送的分片数量
+func (s *Stream) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
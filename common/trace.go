@@ -0,0 +1,186 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName 创建 span 使用的 tracer 名称
+const TracerName = "github.com/zhouyaozhouyao/goframe-jsonrpc"
+
+// TraceCarrier 请求中 trace 字段携带的 trace context，用于无法传递请求头的 tcp 协议
+//
+//	{"jsonrpc": "2.0", "id": "1", "method": "user/info", "params": {"id": 1},
+//	 "trace": {"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+type TraceCarrier map[string]string
+
+// Get 实现 propagation.TextMapCarrier
+func (c TraceCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set 实现 propagation.TextMapCarrier
+func (c TraceCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+// Keys 实现 propagation.TextMapCarrier
+func (c TraceCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Tracing 链路追踪，服务端为每个请求创建 span，客户端为每次调用创建 span 并传递 trace context
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracing 创建链路追踪，provider 为 nil 时使用 otel.GetTracerProvider()
+// propagator 为 nil 时使用 W3C trace context 与 baggage
+func NewTracing(provider trace.TracerProvider, propagator propagation.TextMapPropagator) *Tracing {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	if propagator == nil {
+		propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	}
+	return &Tracing{tracer: provider.Tracer(TracerName), propagator: propagator}
+}
+
+// StartClient 创建客户端 span，单个请求以方法名命名，批量请求命名为 jsonrpc.batch，t 为 nil 时返回不记录的 span
+func (t *Tracing) StartClient(ctx context.Context, methods ...string) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	name := "jsonrpc.batch"
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("jsonrpc")}
+	if len(methods) == 1 {
+		name = methods[0]
+		attrs = append(attrs, semconv.RPCJsonrpcMethodKey.String(methods[0]))
+	} else {
+		attrs = append(attrs, attribute.Int("rpc.jsonrpc.batch_size", len(methods)))
+	}
+	return t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// Inject 将上下文中的 trace context 写入 carrier，如 propagation.HeaderCarrier(req.Header)
+func (t *Tracing) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if t != nil {
+		t.propagator.Inject(ctx, carrier)
+	}
+}
+
+// InjectBody 为请求体中的每个请求添加 trace 字段，支持批量请求
+func (t *Tracing) InjectBody(ctx context.Context, b []byte) ([]byte, error) {
+	if t == nil {
+		return b, nil
+	}
+	carrier := t.carrier(ctx)
+	if carrier == nil {
+		return b, nil
+	}
+	field, err := json.Marshal(carrier)
+	if err != nil {
+		return nil, err
+	}
+	list, batch, err := SplitBatch(b)
+	if err != nil {
+		return nil, err
+	}
+	for i, raw := range list {
+		var req map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &req); err != nil {
+			return nil, err
+		}
+		req["trace"] = field
+		if list[i], err = json.Marshal(req); err != nil {
+			return nil, err
+		}
+	}
+	if batch {
+		return json.Marshal(list)
+	}
+	return list[0], nil
+}
+
+// carrier 返回 ctx 中的 trace context，未开启或没有 span 时返回 nil
+func (t *Tracing) carrier(ctx context.Context) TraceCarrier {
+	if t == nil {
+		return nil
+	}
+	carrier := TraceCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// EndSpan 按调用结果设置 span 状态后结束，服务端错误响应记录错误码
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			span.SetAttributes(semconv.RPCJsonrpcErrorCodeKey.Int(e.Code), semconv.RPCJsonrpcErrorMessageKey.String(e.Message))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetTracing 开启服务端链路追踪，t 为 nil 时关闭
+// 请求的父节点依次从请求的 trace 字段与 http 请求头中读取
+func (svr *Server) SetTracing(t *Tracing) {
+	svr.tracing.Store(t)
+}
+
+// Tracing 返回服务端链路追踪，未开启时返回 nil
+func (svr *Server) Tracing() *Tracing {
+	t, _ := svr.tracing.Load().(*Tracing)
+	return t
+}
+
+// startServer 以请求携带的 trace context 为父节点创建服务端 span，name 为 服务名.方法名
+func (t *Tracing) startServer(ctx context.Context, req *RawRequest, name string, svc *Service, m *Method) (context.Context, trace.Span) {
+	if len(req.Trace) > 0 {
+		ctx = t.propagator.Extract(ctx, req.Trace)
+	} else if peer := PeerFromContext(ctx); peer != nil && peer.Header != nil {
+		ctx = t.propagator.Extract(ctx, propagation.HeaderCarrier(peer.Header))
+	}
+	attrs := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("jsonrpc"),
+		semconv.RPCJsonrpcVersionKey.String(req.JsonRpc),
+		semconv.RPCJsonrpcMethodKey.String(req.Method),
+	}
+	if svc != nil && m != nil {
+		attrs = append(attrs, semconv.RPCServiceKey.String(svc.Name), semconv.RPCMethodKey.String(m.Name))
+	}
+	if req.Id != nil {
+		attrs = append(attrs, semconv.RPCJsonrpcRequestIDKey.String(fmt.Sprint(req.Id)))
+	}
+	if peer := PeerFromContext(ctx); peer != nil {
+		attrs = append(attrs, semconv.NetPeerIPKey.String(peer.IP()))
+	}
+	return t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// endServer 按响应设置 span 状态后结束
+func endServer(span trace.Span, res interface{}) {
+	if e := responseError(res); e != nil {
+		EndSpan(span, e)
+		return
+	}
+	span.End()
+}
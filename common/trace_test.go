@@ -0,0 +1,162 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceId     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanId      = "00f067aa0ba902b7"
+	testTraceParent = "00-" + testTraceId + "-" + testSpanId + "-01"
+)
+
+func newTestTracing() (*Tracing, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return NewTracing(provider, nil), exporter
+}
+
+func newTraceServer(t *testing.T) (*Server, *tracetest.InMemoryExporter) {
+	svr := newBenchServer(t)
+	tracing, exporter := newTestTracing()
+	svr.SetTracing(tracing)
+	return svr, exporter
+}
+
+// onlySpan 返回导出的唯一 span
+func onlySpan(t *testing.T, exporter *tracetest.InMemoryExporter) tracetest.SpanStub {
+	t.Helper()
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	return spans[0]
+}
+
+func assertParent(t *testing.T, span tracetest.SpanStub, traceId, spanId string) {
+	t.Helper()
+	if got := span.Parent.TraceID().String(); got != traceId {
+		t.Errorf("parent trace id %s, want %s", got, traceId)
+	}
+	if got := span.Parent.SpanID().String(); got != spanId {
+		t.Errorf("parent span id %s, want %s", got, spanId)
+	}
+	if !span.Parent.IsRemote() {
+		t.Error("parent should be remote")
+	}
+	if span.SpanContext.TraceID() != span.Parent.TraceID() {
+		t.Error("server span not in the caller's trace")
+	}
+}
+
+func TestServerSpanFromHeader(t *testing.T) {
+	svr, exporter := newTraceServer(t)
+	peer := &Peer{Transport: "http", RemoteAddr: "10.0.0.1:5000", Header: http.Header{}}
+	peer.Header.Set("traceparent", testTraceParent)
+	ctx := WithPeer(context.Background(), peer)
+
+	res := svr.HandlerContext(ctx, []byte(`{"jsonrpc":"2.0","id":"1","method":"arith.add","params":{"a":1,"b":2}}`))
+	if code := responseCode(t, res); code != WithoutError {
+		t.Fatalf("code = %d: %s", code, res)
+	}
+	span := onlySpan(t, exporter)
+	assertParent(t, span, testTraceId, testSpanId)
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("span kind %s, want server", span.SpanKind)
+	}
+	if span.Name != "arith.Add" {
+		t.Errorf("span name %s, want arith.Add", span.Name)
+	}
+	if span.Status.Code == codes.Error {
+		t.Errorf("successful call has error status %q", span.Status.Description)
+	}
+}
+
+func TestServerSpanFromEnvelope(t *testing.T) {
+	svr, exporter := newTraceServer(t)
+	// trace 字段优先于请求头
+	peer := &Peer{Transport: "http", Header: http.Header{}}
+	peer.Header.Set("traceparent", "00-11111111111111111111111111111111-2222222222222222-01")
+	ctx := WithPeer(context.Background(), peer)
+
+	req := `{"jsonrpc":"2.0","id":"1","method":"arith.nope","trace":{"traceparent":"` + testTraceParent + `"}}`
+	if code := responseCode(t, svr.HandlerContext(ctx, []byte(req))); code != MethodNotFound {
+		t.Fatalf("code = %d, want %d", code, MethodNotFound)
+	}
+	span := onlySpan(t, exporter)
+	assertParent(t, span, testTraceId, testSpanId)
+	// 错误响应记录错误码与 span 状态
+	if span.Status.Code != codes.Error {
+		t.Errorf("status %v, want error", span.Status.Code)
+	}
+	var code int64
+	for _, kv := range span.Attributes {
+		if kv.Key == "rpc.jsonrpc.error_code" {
+			code = kv.Value.AsInt64()
+		}
+	}
+	if code != MethodNotFound {
+		t.Errorf("error code attribute %d, want %d", code, MethodNotFound)
+	}
+}
+
+func TestClientSpanInjection(t *testing.T) {
+	tracing, exporter := newTestTracing()
+	ctx, span := tracing.StartClient(context.Background(), "arith.add")
+	sc := span.SpanContext()
+
+	header := http.Header{}
+	tracing.Inject(ctx, propagation.HeaderCarrier(header))
+	want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"
+	if got := header.Get("traceparent"); got != want {
+		t.Errorf("traceparent header %q, want %q", got, want)
+	}
+
+	// 批量请求的每个元素都携带 trace 字段
+	body, err := tracing.InjectBody(ctx, []byte(`[{"jsonrpc":"2.0","id":"1","method":"arith.add","params":[1,2]},{"jsonrpc":"2.0","id":"2","method":"arith.add","params":[3,4]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []struct {
+		Trace TraceCarrier `json:"trace"`
+	}
+	if err = json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range list {
+		if r.Trace.Get("traceparent") != want {
+			t.Errorf("element %d trace %v, want %s", i, r.Trace, want)
+		}
+	}
+	EndSpan(span, nil)
+	client := onlySpan(t, exporter)
+	if client.SpanKind != trace.SpanKindClient || client.Name != "arith.add" {
+		t.Errorf("client span %s %s, want client arith.add", client.SpanKind, client.Name)
+	}
+
+	// 服务端 span 以客户端 span 为父节点
+	svr, serverExporter := newTraceServer(t)
+	svr.HandlerContext(context.Background(), body)
+	spans := serverExporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d server spans, want 2", len(spans))
+	}
+	for _, s := range spans {
+		assertParent(t, s, sc.TraceID().String(), sc.SpanID().String())
+	}
+
+	// 未开启链路追踪时不修改请求
+	var off *Tracing
+	if b, _ := off.InjectBody(ctx, []byte(`{"id":"1"}`)); string(b) != `{"id":"1"}` {
+		t.Errorf("nil tracing modified body: %s", b)
+	}
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/gogf/gf/v2/util/gvalid"
+)
+
+// ParamInvalid 参数未通过 v 标签声明的校验规则
+const ParamInvalid = "invalid"
+
+// validTags gvalid 支持的校验标签
+var validTags = []string{"v", "valid", "gvalid"}
+
+// ValidateParams 按结构体 v 标签声明的 gvalid 规则校验参数，失败时返回 *BindError
+//
+//	type Params struct {
+//		Name  string `json:"name" v:"required|length:2,20#请输入名称|名称长度为 {min} 到 {max} 个字符"`
+//		Email string `json:"email" v:"email"`
+//	}
+func ValidateParams(ctx context.Context, pv interface{}) error {
+	verr := gvalid.New().Data(pv).Run(ctx)
+	if verr == nil {
+		return nil
+	}
+	names := jsonNames(reflect.TypeOf(pv), make(map[string]string), make(map[reflect.Type]bool))
+	be := &BindError{}
+	for _, item := range verr.Items() {
+		for key, rules := range item {
+			field := key
+			if name, ok := names[key]; ok {
+				field = name
+			}
+			// 同一字段的多条规则按名称排序，保证返回顺序稳定
+			ruleNames := make([]string, 0, len(rules))
+			for rule := range rules {
+				ruleNames = append(ruleNames, rule)
+			}
+			sort.Strings(ruleNames)
+			for _, rule := range ruleNames {
+				be.Errors = append(be.Errors, ParamError{
+					Field:   field,
+					Reason:  ParamInvalid,
+					Rule:    rule,
+					Message: rules[rule].Error(),
+				})
+			}
+		}
+	}
+	return be
+}
+
+// hasValidTags 检测结构体及其嵌套的结构体是否声明了校验规则，注册方法时判断一次
+func hasValidTags(t reflect.Type, visited map[reflect.Type]bool) bool {
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return hasValidTags(t.Elem(), visited)
+	case reflect.Struct:
+	default:
+		return false
+	}
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		for _, tag := range validTags {
+			if _, ok := sf.Tag.Lookup(tag); ok {
+				return true
+			}
+		}
+		if hasValidTags(sf.Type, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonNames 收集结构体字段名到 json 名称的映射，gvalid 的错误以字段名作为键
+func jsonNames(t reflect.Type, names map[string]string, visited map[reflect.Type]bool) map[string]string {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct || visited[t] {
+		return names
+	}
+	visited[t] = true
+	for _, f := range structFields(t) {
+		goName := t.FieldByIndex(f.index).Name
+		if _, ok := names[goName]; !ok {
+			names[goName] = f.name
+		}
+		ft := indirectType(f.typ)
+		if ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array || ft.Kind() == reflect.Map {
+			ft = ft.Elem()
+		}
+		jsonNames(ft, names, visited)
+	}
+	return names
+}
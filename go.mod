@@ -1,9 +1,15 @@
 module github.com/zhouyaozhouyao/goframe-jsonrpc
 
-go 1.17
+go 1.18
 
 require (
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/gogf/gf/v2 v2.0.6
+	github.com/klauspost/compress v1.16.7
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
 	golang.org/x/time v0.0.0-20220411224347-583f2d630306
 )
 
@@ -17,9 +23,8 @@ require (
 	github.com/go-redis/redis/v8 v8.11.4 // indirect
 	github.com/mattn/go-colorable v0.1.9 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
-	go.opentelemetry.io/otel v1.0.0 // indirect
-	go.opentelemetry.io/otel/sdk v1.0.0 // indirect
-	go.opentelemetry.io/otel/trace v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/sys v0.0.0-20210809222454-d867a43fc93e // indirect
 	golang.org/x/text v0.3.8-0.20211105212822-18b340fc7af2 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
@@ -1,8 +1,10 @@
 package jsonrpc
 
 import (
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
 	"github.com/zhouyaozhouyao/goframe-jsonrpc/server"
 
+	"context"
 	"errors"
 
 	"golang.org/x/time/rate"
@@ -23,11 +25,81 @@ type ServerInterface interface {
 	// int 每秒请求速率 20
 	SetRateLimit(rate.Limit, int)
 
+	// AddRateLimit 添加按调用方、服务或方法分组的限流规则，可添加多条，请求需要通过所有规则
+	// 被限流的请求返回 common.RateLimited 错误，http 协议在所有请求都被限流时返回 429
+	AddRateLimit(common.RateLimit)
+
+	// SetAuth 设置认证方式，支持 Bearer 令牌、HMAC 签名与 api key，未通过认证的请求返回 common.Unauthorized 错误
+	// 认证信息可以通过 http 请求头 Authorization、tcp 连接的 rpc.auth 握手或请求中的 auth 字段传递
+	// 方法通过 common.PrincipalFromContext(ctx) 获取调用方身份
+	SetAuth(common.AuthOptions)
+
+	// SetSign 开启请求签名校验，签名为请求中的 sign 字段，校验时间戳偏差并通过 nonce 防止重放
+	// 未通过校验的请求返回 common.Unauthorized 错误
+	SetSign(common.SignOptions)
+
+	// SetACL 设置方法级别的访问控制规则，按认证后调用方的角色与授权范围限制可以调用的方法
+	// 没有权限的请求返回 common.Forbidden 错误，规则可以通过 common.LoadACL 从配置文件读取
+	SetACL(*common.ACL)
+
+	// SetMetrics 开启请求数、错误数、耗时、并发数、批量大小、限流次数与连接数指标，需要在 Start 前调用
+	// 多个服务可以共享同一个注册表，http 协议设置 HttpOptions.MetricsPath 后通过该路径开放指标
+	// 注册表中的同名指标类型或标签不一致时返回错误
+	SetMetrics(r *common.Registry) error
+
+	// SetTracing 开启链路追踪，为每个请求创建服务端 span，方法通过 ctx 创建子 span
+	// 父节点从请求的 trace 字段或 http 请求头 traceparent 中读取，默认使用 W3C trace context
+	SetTracing(t *common.Tracing)
+
+	// SetLog 设置访问日志，每个请求输出一条包含 id、方法、耗时、错误码、调用方地址与批量位置的日志
+	// 记录参数时按 Redact 脱敏，日志通过 common.Logger 接口接入，默认使用 glog
+	SetLog(common.LogOptions)
+
+	// AddHealthCheck 添加健康检查，rpc.health 方法与 http 协议的 /readyz 执行所有检查
+	// 内置 rpc.ping 方法与 http 协议的 /healthz 用于存活检测
+	AddHealthCheck(name string, check common.HealthCheck)
+
+	// SetReady 设置是否就绪，未就绪时 /readyz 返回 503，Shutdown 时自动设置为未就绪
+	SetReady(ready bool)
+
+	// Shutdown 优雅关闭，标记为未就绪并等待 ShutdownDelay 后停止接收连接，等待处理中的请求完成或 ctx 取消
+	Shutdown(ctx context.Context) error
+
+	// SetMethodConcurrency 限制单个方法同时执行的调用数，超过时排队，排队失败返回 common.Overloaded 错误
+	// 需要在注册服务后调用，所有方法的并发限制与最大连接数通过 SetOptions 设置
+	SetMethodConcurrency(method string, c common.Concurrency) error
+
 	// Start 启动入口
 	Start()
 
-	// Register jsonrpc 服务注册
-	Register(s interface{})
+	// Register jsonrpc 服务注册，返回的 *common.RegisterError 列出签名不符合要求的方法
+	// 严格模式下只要存在这类方法就注册失败，宽松模式下跳过这些方法，只有没有可注册的方法时才返回错误
+	Register(s interface{}) error
+
+	// RegisterName 以指定的名称注册服务，不再使用 Go 类型名
+	RegisterName(name string, s interface{}) error
+
+	// Replace 替换已注册的服务，正在进行的调用继续使用旧的服务实例完成
+	Replace(name string, s interface{}) error
+
+	// Unregister 注销服务，正在进行的调用不受影响
+	Unregister(name string) error
+
+	// SetStrict 设置严格模式，需要在注册服务前调用
+	SetStrict(bool)
+
+	// RegisterFunc 将函数注册为指定名称的方法 如 RegisterFunc("math.add", fn)
+	// fn 的签名为 func(*P, *R) error 或 func(context.Context, *P, *R) error
+	RegisterFunc(name string, fn interface{}) error
+
+	// Alias 为已注册的方法设置别名 如 Alias("calc.sum", "IntRpc.Add")
+	Alias(alias string, method string) error
+
+	// SetStrictParams 设置参数严格模式，不允许未知字段、缺少必填字段以及类型转换
+	SetStrictParams(bool)
+
+	// SetNaming 设置服务名与方法名的命名策略，需要在注册服务前调用
+	SetNaming(common.NamingStrategy)
 }
 
 func NewServer(protocol string, ip string, port string) (ServerInterface, error) {
@@ -41,3 +113,19 @@ func NewServer(protocol string, ip string, port string) (ServerInterface, error)
 	}
 	return nil, errors.New("未找到匹配的协议")
 }
+
+// HandleFunc 以 func(ctx, P) (R, error) 的形式注册方法，省去定义服务结构体
+//
+//	jsonrpc.HandleFunc(s, "math.add", func(ctx context.Context, p Params) (int, error) {
+//		return p.A + p.B, nil
+//	})
+func HandleFunc[P any, R any](s ServerInterface, name string, fn func(ctx context.Context, params P) (R, error)) error {
+	return s.RegisterFunc(name, func(ctx context.Context, params *P, result *R) error {
+		r, err := fn(ctx, *params)
+		if err != nil {
+			return err
+		}
+		*result = r
+		return nil
+	})
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+type whoService struct{}
+
+// Who 返回调用方标识，未认证时返回 anonymous
+func (whoService) Who(ctx context.Context, args *slowArgs, result *string) error {
+	*result = "anonymous"
+	if p := common.PrincipalFromContext(ctx); p != nil {
+		*result = p.Id
+	}
+	return nil
+}
+
+func authOptions() common.AuthOptions {
+	return common.AuthOptions{Authenticators: []common.Authenticator{
+		common.BearerAuth(func(ctx context.Context, token string) (*common.Principal, error) {
+			if token != "t1" {
+				return nil, common.ErrBadCredentials
+			}
+			return &common.Principal{Id: "alice"}, nil
+		}),
+		common.APIKeyAuth(map[string]*common.Principal{"k1": {Id: "bob"}}),
+	}}
+}
+
+func whoResult(t *testing.T, b []byte) string {
+	t.Helper()
+	var r struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatalf("invalid response %q: %v", b, err)
+	}
+	return r.Result
+}
+
+const whoRequest = `{"jsonrpc":"2.0","id":"1","method":"who.who","params":{"n":1}}`
+
+func TestHttpAuth(t *testing.T) {
+	_, addr := startHttp(t, newSlowService(), func(s *Http) {
+		if err := s.Server.RegisterName("who", whoService{}); err != nil {
+			t.Fatal(err)
+		}
+		s.SetAuth(authOptions())
+	})
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+		want   string
+	}{
+		{"missing", http.Header{}, http.StatusUnauthorized, ""},
+		{"bearer", http.Header{"Authorization": {"Bearer t1"}}, http.StatusOK, "alice"},
+		{"bearer wrong token", http.Header{"Authorization": {"Bearer t2"}}, http.StatusUnauthorized, ""},
+		{"api key header", http.Header{"X-Api-Key": {"k1"}}, http.StatusOK, "bob"},
+		{"api key wrong key", http.Header{"X-Api-Key": {"k2"}}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr, strings.NewReader(whoRequest))
+		req.Header = tt.header
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b []byte
+		b, err = readAll(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status || whoResult(t, b) != tt.want {
+			t.Errorf("%s: %d %s, want %d %q", tt.name, resp.StatusCode, b, tt.status, tt.want)
+		}
+		if tt.status == http.StatusUnauthorized && responseCode(t, b) != common.Unauthorized {
+			t.Errorf("%s: code = %d", tt.name, responseCode(t, b))
+		}
+	}
+}
+
+// tcp 认证握手的身份在该连接的后续请求中保持，不影响其它连接
+func TestTcpAuthHandshake(t *testing.T) {
+	_, addr := startTcp(t, newSlowService(), func(s *Tcp) {
+		if err := s.Server.RegisterName("who", whoService{}); err != nil {
+			t.Fatal(err)
+		}
+		s.SetAuth(authOptions())
+	})
+	c := dial(t, addr)
+	if b := c.call(t, whoRequest); responseCode(t, b) != common.Unauthorized {
+		t.Errorf("before handshake = %s", b)
+	}
+	if b := c.call(t, `{"jsonrpc":"2.0","id":"a","method":"rpc.auth","params":["ApiKey k2"]}`); responseCode(t, b) != common.Unauthorized {
+		t.Errorf("wrong key handshake = %s", b)
+	}
+	if b := c.call(t, `{"jsonrpc":"2.0","id":"a","method":"rpc.auth","params":["ApiKey k1"]}`); responseCode(t, b) != common.WithoutError {
+		t.Fatalf("handshake = %s", b)
+	}
+	for i := 0; i < 3; i++ {
+		if b := c.call(t, whoRequest); whoResult(t, b) != "bob" {
+			t.Errorf("request %d = %s", i, b)
+		}
+	}
+	if b := dial(t, addr).call(t, whoRequest); responseCode(t, b) != common.Unauthorized {
+		t.Errorf("other connection = %s", b)
+	}
+}
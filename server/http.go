@@ -1,12 +1,19 @@
 package server
 
 import (
-	"crm/jsonrpc/common"
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
 	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/time/rate"
 )
@@ -16,14 +23,28 @@ type Http struct {
 	Port    string
 	Server  common.Server
 	Options HttpOptions
+	server  *http.Server // Start 创建的 http 服务，Shutdown 时关闭
+	counted sync.Map     // 计入连接数指标的连接 => 计数时的 *common.ServerMetrics
+	mu      sync.Mutex
 }
 
 type HttpOptions struct {
+	PackageMaxLength   int64         // 请求体解压后的最大长度，不大于 0 时不限制
+	CompressThreshold  int           // 压缩阈值，小于该长度的响应不压缩，不大于 0 时使用 common.DefaultCompressThreshold
+	DisableCompression bool          // 关闭响应压缩，请求体仍按 Content-Encoding 解压
+	MaxConnections     int           // 最大连接数，超过时直接返回 503 并关闭连接，不大于 0 时不限制，需要在 Start 前设置
+	MaxInFlight        int           // 所有方法同时执行的最大调用数，不大于 0 时不限制，通过 SetOptions 设置或在 Start 前修改
+	MaxQueue           int           // 超过 MaxInFlight 时排队的最大调用数，队列已满时返回 503
+	QueueTimeout       time.Duration // 排队的最长时间，为 0 时等待到请求取消
+	MetricsPath        string        // 指标的访问路径 如 /metrics，为空时不开放，未调用 SetMetrics 时使用 common.DefaultRegistry，需要在 Start 前设置
+	ShutdownDelay      time.Duration // 关闭时先标记为未就绪，等待该时间让负载均衡摘除实例后再停止接收连接
 }
 
 // NewHttpServer 启动入口
 func NewHttpServer(ip string, port string) *Http {
-	options := HttpOptions{}
+	options := HttpOptions{
+		PackageMaxLength: 1024 * 1024 * 2,
+	}
 	return &Http{
 		Ip:   ip,
 		Port: port,
@@ -42,10 +63,70 @@ func (p *Http) Start() {
 	mux := http.NewServeMux()
 	// 注册根路由
 	mux.HandleFunc("/", p.handleFunc)
+	// 存活检测与就绪检测
+	mux.HandleFunc("/healthz", p.healthz)
+	mux.HandleFunc("/readyz", p.readyz)
+	// 以 Prometheus 文本格式开放指标
+	if p.Options.MetricsPath != "" {
+		if p.Server.Metrics() == nil {
+			if err := p.Server.SetMetrics(common.DefaultRegistry); err != nil {
+				log.Println(err)
+			}
+		}
+		if sm := p.Server.Metrics(); sm != nil {
+			mux.Handle(p.Options.MetricsPath, sm.Registry.Handler())
+		}
+	}
+	// 直接修改 Options 设置的并发限制在启动时生效
+	if p.Options.MaxInFlight > 0 {
+		p.Server.SetConcurrency(p.concurrency())
+	}
 	// 启动服务
 	var url = fmt.Sprintf("%s:%s", p.Ip, p.Port)
+	listener, err := net.Listen("tcp", url)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if p.Options.MaxConnections > 0 {
+		listener = &limitListener{Listener: listener, max: int64(p.Options.MaxConnections)}
+	}
 	log.Printf("Listening http://%s:%s", p.Ip, p.Port)
-	_ = http.ListenAndServe(url, mux)
+	server := &http.Server{Handler: mux, ConnState: p.connState}
+	p.mu.Lock()
+	p.server = server
+	p.mu.Unlock()
+	if err = server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		log.Println(err)
+	}
+}
+
+// Shutdown 优雅关闭，先标记为未就绪，等待 ShutdownDelay 后停止接收连接，并等待处理中的请求完成或 ctx 取消
+func (p *Http) Shutdown(ctx context.Context) error {
+	p.Server.SetReady(false)
+	if p.Options.ShutdownDelay > 0 {
+		select {
+		case <-time.After(p.Options.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// AddHealthCheck 添加健康检查
+func (p *Http) AddHealthCheck(name string, check common.HealthCheck) {
+	p.Server.AddHealthCheck(name, check)
+}
+
+// SetReady 设置是否就绪
+func (p *Http) SetReady(ready bool) {
+	p.Server.SetReady(ready)
 }
 
 func (p *Http) SetBeforeFunc(beforeFunc func(id interface{}, method string, params interface{}) error) {
@@ -58,6 +139,12 @@ func (p *Http) SetAfterFunc(afterFunc func(id interface{}, method string, result
 
 func (p *Http) SetOptions(httpOptions interface{}) {
 	p.Options = httpOptions.(HttpOptions)
+	p.Server.SetConcurrency(p.concurrency())
+}
+
+// concurrency 按配置生成全局并发限制
+func (p *Http) concurrency() common.Concurrency {
+	return common.Concurrency{Max: p.Options.MaxInFlight, Queue: p.Options.MaxQueue, QueueTimeout: p.Options.QueueTimeout}
 }
 
 func (p *Http) SetRateLimit(r rate.Limit, b int) {
@@ -65,8 +152,88 @@ func (p *Http) SetRateLimit(r rate.Limit, b int) {
 	p.Server.RateLimiter = rate.NewLimiter(r, b)
 }
 
-func (p *Http) Register(s interface{}) {
-	_ = p.Server.Register(s)
+// SetAuth 设置认证方式
+func (p *Http) SetAuth(o common.AuthOptions) {
+	p.Server.SetAuth(o)
+}
+
+// SetSign 开启请求签名校验
+func (p *Http) SetSign(o common.SignOptions) {
+	p.Server.SetSign(o)
+}
+
+// SetACL 设置方法级别的访问控制规则
+func (p *Http) SetACL(acl *common.ACL) {
+	p.Server.SetACL(acl)
+}
+
+// AddRateLimit 添加分组限流规则
+func (p *Http) AddRateLimit(rule common.RateLimit) {
+	p.Server.AddRateLimit(rule)
+}
+
+// SetMetrics 开启指标，r 为 nil 时关闭，注册指标失败时返回错误
+func (p *Http) SetMetrics(r *common.Registry) error {
+	return p.Server.SetMetrics(r)
+}
+
+// SetLog 设置访问日志
+func (p *Http) SetLog(o common.LogOptions) {
+	p.Server.SetLog(o)
+}
+
+// SetTracing 开启链路追踪
+func (p *Http) SetTracing(t *common.Tracing) {
+	p.Server.SetTracing(t)
+}
+
+// SetMethodConcurrency 限制单个方法的并发调用数
+func (p *Http) SetMethodConcurrency(method string, c common.Concurrency) error {
+	return p.Server.SetMethodConcurrency(method, c)
+}
+
+func (p *Http) Register(s interface{}) error {
+	return p.Server.Register(s)
+}
+
+// RegisterName 以指定的名称注册服务
+func (p *Http) RegisterName(name string, s interface{}) error {
+	return p.Server.RegisterName(name, s)
+}
+
+// Replace 替换已注册的服务
+func (p *Http) Replace(name string, s interface{}) error {
+	return p.Server.Replace(name, s)
+}
+
+// Unregister 注销服务
+func (p *Http) Unregister(name string) error {
+	return p.Server.Unregister(name)
+}
+
+// RegisterFunc 将函数注册为指定名称的方法
+func (p *Http) RegisterFunc(name string, fn interface{}) error {
+	return p.Server.RegisterFunc(name, fn)
+}
+
+// Alias 为已注册的方法设置别名
+func (p *Http) Alias(alias string, method string) error {
+	return p.Server.Alias(alias, method)
+}
+
+// SetStrict 设置严格模式，服务存在签名错误的导出方法时注册失败
+func (p *Http) SetStrict(strict bool) {
+	p.Server.Strict = strict
+}
+
+// SetStrictParams 设置参数严格模式，不允许未知字段、缺少必填字段以及类型转换
+func (p *Http) SetStrictParams(strict bool) {
+	p.Server.StrictParams = strict
+}
+
+// SetNaming 设置服务名与方法名的命名策略，需要在注册服务前调用
+func (p *Http) SetNaming(naming common.NamingStrategy) {
+	p.Server.Naming = naming
 }
 
 // handleFunc 注册路由
@@ -75,8 +242,13 @@ func (p *Http) handleFunc(w http.ResponseWriter, r *http.Request) {
 		err  error
 		data []byte
 	)
+	// 根据请求头 Content-Type 选择编码，未设置或无法识别时使用 json
+	codec, ok := common.GetCodec(r.Header.Get("Content-Type"))
+	if !ok {
+		codec = common.JSON
+	}
 	// 添加请求头类型
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", codec.ContentType())
 	// 读取文件或网络请求 ioutil.ReadAll
 	if data, err = ioutil.ReadAll(r.Body); err != nil {
 		// 响应状态码 500 服务器异常
@@ -88,7 +260,142 @@ func (p *Http) handleFunc(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	resp := p.Server.Handler(data)
+	// 根据请求头 Content-Encoding 解压请求体
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		compressor, ok := common.GetCompressor(encoding)
+		if !ok {
+			// 响应状态码 415 不支持的压缩算法
+			w.Header().Set("Accept-Encoding", common.AcceptEncoding())
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		data, err = compressor.Decompress(data, p.Options.PackageMaxLength)
+	}
+	var resp []byte
+	status := http.StatusOK
+	if err != nil {
+		common.DebugContext(r.Context(), err.Error())
+		resp, _ = common.Encode(codec, common.E(nil, common.JsonRpc, common.ParseError))
+	} else {
+		// 签名覆盖解压后的请求体
+		peer := &common.Peer{Transport: "http", RemoteAddr: r.RemoteAddr, Header: r.Header}
+		if authorization := r.Header.Get("Authorization"); authorization != "" {
+			p.Server.AuthenticatePeer(r.Context(), peer, authorization, data)
+		} else if key := r.Header.Get("X-Api-Key"); key != "" {
+			p.Server.AuthenticatePeer(r.Context(), peer, "ApiKey "+key, data)
+		}
+		// 请求与响应直接按协商的编码解析与序列化
+		resp = p.Server.HandlerCodec(common.WithPeer(r.Context(), peer), codec, data)
+		// 所有请求都被拒绝时按原因返回 429、503、401 或 403，限流时通过 Retry-After 告知等待的秒数
+		switch code, delay := peer.Rejected(); code {
+		case common.RateLimited:
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			status = http.StatusTooManyRequests
+		case common.Overloaded:
+			status = http.StatusServiceUnavailable
+		case common.Unauthorized:
+			status = http.StatusUnauthorized
+		case common.Forbidden:
+			status = http.StatusForbidden
+		}
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp = p.compress(w, r, resp)
+	w.WriteHeader(status)
 	// 返回结果
 	_, _ = w.Write(resp)
 }
+
+// healthz 存活检测，服务可以处理请求时返回 200
+func (p *Http) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"ok"}`))
+}
+
+// readyz 就绪检测，已就绪并且所有健康检查通过时返回 200，否则返回 503
+func (p *Http) readyz(w http.ResponseWriter, r *http.Request) {
+	h := p.Server.Health(r.Context())
+	b, _ := json.Marshal(h)
+	w.Header().Set("Content-Type", "application/json")
+	if !h.OK() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(b)
+}
+
+// compress 根据请求头 Accept-Encoding 压缩响应，长度小于阈值或压缩失败时原样返回
+func (p *Http) compress(w http.ResponseWriter, r *http.Request, resp []byte) []byte {
+	if p.Options.DisableCompression {
+		return resp
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(resp) < common.CompressThreshold(p.Options.CompressThreshold) {
+		return resp
+	}
+	compressor, ok := common.NegotiateCompressor(r.Header.Get("Accept-Encoding"))
+	if !ok {
+		return resp
+	}
+	b, err := compressor.Compress(resp)
+	if err != nil {
+		common.DebugContext(r.Context(), err.Error())
+		return resp
+	}
+	w.Header().Set("Content-Encoding", compressor.Name())
+	return b
+}
+
+// connState 开启指标时统计当前的连接数，连接关闭时从建立时计数的指标中减去，开启指标前建立的连接不计数
+func (p *Http) connState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		if sm := p.Server.Metrics(); sm != nil {
+			p.counted.Store(conn, sm)
+			sm.Connections.Add(1, "http")
+		}
+	case http.StateHijacked, http.StateClosed:
+		if sm, ok := p.counted.LoadAndDelete(conn); ok {
+			sm.(*common.ServerMetrics).Connections.Add(-1, "http")
+		}
+	}
+}
+
+// limitListener 限制同时保持的连接数，超过时返回 503 并关闭新连接
+type limitListener struct {
+	net.Listener
+	max   int64
+	conns int64
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if atomic.AddInt64(&l.conns, 1) <= l.max {
+			return &limitConn{Conn: conn, release: func() { atomic.AddInt64(&l.conns, -1) }}, nil
+		}
+		atomic.AddInt64(&l.conns, -1)
+		go func() {
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+			_, _ = conn.Write([]byte("HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\nContent-Length: 0\r\n\r\n"))
+			_ = conn.Close()
+		}()
+	}
+}
+
+// limitConn 关闭时释放连接数
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+const fastRequest = `{"jsonrpc":"2.0","id":"1","method":"svc.fast","params":{"n":1}}`
+
+// metricLine 返回指标文本中以 prefix 开头的一行的值
+func metricLine(t *testing.T, text string, prefix string) (string, bool) {
+	t.Helper()
+	s := bufio.NewScanner(strings.NewReader(text))
+	for s.Scan() {
+		if strings.HasPrefix(s.Text(), prefix+" ") {
+			return strings.TrimPrefix(s.Text(), prefix+" "), true
+		}
+	}
+	return "", false
+}
+
+// waitGauge 等待注册表中的指标变为 want
+func waitGauge(t *testing.T, r *common.Registry, prefix string, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var buf bytes.Buffer
+		_, _ = r.WriteTo(&buf)
+		got, _ := metricLine(t, buf.String(), prefix)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q, want %q", prefix, got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHttpMetricsEndpoint(t *testing.T) {
+	r := common.NewRegistry()
+	_, addr := startHttp(t, newSlowService(), func(s *Http) {
+		o := s.Options
+		o.MetricsPath = "/metrics"
+		s.SetOptions(o)
+		if err := s.SetMetrics(r); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if status, b := post(t, addr, fastRequest); status != http.StatusOK {
+		t.Fatalf("call = %d %s", status, b)
+	}
+	post(t, addr, `{"jsonrpc":"2.0","id":"1","method":"svc.missing"}`)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := readAll(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	text := string(b)
+	for prefix, want := range map[string]string{
+		`jsonrpc_server_requests_total{method="svc.Fast"}`:                            "1",
+		`jsonrpc_server_requests_total{method="unknown"}`:                             "1",
+		`jsonrpc_server_errors_total{method="unknown",code="-32601"}`:                 "1",
+		`jsonrpc_server_request_duration_seconds_count{method="svc.Fast"}`:            "1",
+		`jsonrpc_server_request_duration_seconds_bucket{method="svc.Fast",le="+Inf"}`: "1",
+		`jsonrpc_server_in_flight`:                                                    "0",
+	} {
+		if got, ok := metricLine(t, text, prefix); !ok || got != want {
+			t.Errorf("%s = %q, want %q", prefix, got, want)
+		}
+	}
+	for _, line := range []string{"# TYPE jsonrpc_server_requests_total counter", "# TYPE jsonrpc_server_request_duration_seconds histogram", "# TYPE jsonrpc_server_connections gauge"} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, text)
+		}
+	}
+}
+
+// 开启指标前建立的连接关闭时不减少连接数
+func TestHttpConnectionsGauge(t *testing.T) {
+	s, addr := startHttp(t, newSlowService(), nil)
+	before := &http.Transport{}
+	request := func(tr *http.Transport) {
+		t.Helper()
+		resp, err := (&http.Client{Transport: tr}).Post("http://"+addr, "application/json", strings.NewReader(fastRequest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = readAll(resp)
+	}
+	request(before)
+
+	r := common.NewRegistry()
+	if err := s.SetMetrics(r); err != nil {
+		t.Fatal(err)
+	}
+	const gauge = `jsonrpc_server_connections{transport="http"}`
+	after := &http.Transport{}
+	request(after)
+	waitGauge(t, r, gauge, "1")
+
+	before.CloseIdleConnections()
+	request(after)
+	waitGauge(t, r, gauge, "1")
+
+	after.CloseIdleConnections()
+	waitGauge(t, r, gauge, "0")
+}
+
+func TestTcpConnectionsGauge(t *testing.T) {
+	r := common.NewRegistry()
+	_, addr := startTcp(t, newSlowService(), func(s *Tcp) {
+		if err := s.SetMetrics(r); err != nil {
+			t.Fatal(err)
+		}
+	})
+	const gauge = `jsonrpc_server_connections{transport="tcp"}`
+	c := dial(t, addr)
+	c.call(t, fastRequest)
+	waitGauge(t, r, gauge, "1")
+	_ = c.Close()
+	waitGauge(t, r, gauge, "0")
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+type slowArgs struct {
+	N int `json:"n"`
+}
+
+type slowService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newSlowService() *slowService {
+	return &slowService{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (s *slowService) Slow(args *slowArgs, result *int) error {
+	s.started <- struct{}{}
+	<-s.release
+	*result = args.N
+	return nil
+}
+
+func (s *slowService) Fast(args *slowArgs, result *int) error {
+	*result = args.N
+	return nil
+}
+
+// freePort 返回一个空闲的本地端口
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// waitListening 等待服务端开始监听
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not listening: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startHttp 启动注册了 svc 服务的 http 服务端，configure 在启动前修改配置
+func startHttp(t *testing.T, svc *slowService, configure func(s *Http)) (*Http, string) {
+	t.Helper()
+	s := NewHttpServer("127.0.0.1", freePort(t))
+	if err := s.Server.RegisterName("svc", svc); err != nil {
+		t.Fatal(err)
+	}
+	if configure != nil {
+		configure(s)
+	}
+	go s.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	})
+	addr := net.JoinHostPort(s.Ip, s.Port)
+	waitListening(t, addr)
+	return s, addr
+}
+
+// startTcp 启动注册了 svc 服务的 tcp 服务端，configure 在启动前修改配置
+func startTcp(t *testing.T, svc *slowService, configure func(s *Tcp)) (*Tcp, string) {
+	t.Helper()
+	s := NewTcpServer("127.0.0.1", freePort(t))
+	if err := s.Server.RegisterName("svc", svc); err != nil {
+		t.Fatal(err)
+	}
+	if configure != nil {
+		configure(s)
+	}
+	go s.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	})
+	addr := net.JoinHostPort(s.Ip, s.Port)
+	waitListening(t, addr)
+	return s, addr
+}
+
+// post 发送 http 请求，返回状态码与响应体
+func post(t *testing.T, addr string, body string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Post("http://"+addr, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := readAll(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, b
+}
+
+// readAll 读取并关闭响应体
+func readAll(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// tcpConn 按结束符分隔协议收发消息的 tcp 连接
+type tcpConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *tcpConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &tcpConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *tcpConn) send(t *testing.T, body string) {
+	t.Helper()
+	if _, err := c.Write([]byte(body + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *tcpConn) receive(t *testing.T) []byte {
+	t.Helper()
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(strings.TrimSuffix(line, "\r\n"))
+}
+
+func (c *tcpConn) call(t *testing.T, body string) []byte {
+	t.Helper()
+	c.send(t, body)
+	return c.receive(t)
+}
+
+// responseCode 返回响应的错误码，没有错误时返回 common.WithoutError
+func responseCode(t *testing.T, b []byte) int {
+	t.Helper()
+	var resp struct {
+		Error *common.Error `json:"error"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", b, err)
+	}
+	if resp.Error == nil {
+		return common.WithoutError
+	}
+	return resp.Error.Code
+}
+
+// 直接修改 Options 设置的并发限制在 Start 时生效
+func TestStartAppliesConcurrency(t *testing.T) {
+	const slow, fast = `{"jsonrpc":"2.0","id":"1","method":"svc.slow","params":{"n":1}}`, `{"jsonrpc":"2.0","id":"2","method":"svc.fast","params":{"n":2}}`
+	t.Run("http", func(t *testing.T) {
+		svc := newSlowService()
+		_, addr := startHttp(t, svc, func(s *Http) { s.Options.MaxInFlight = 1 })
+		done := make(chan int, 1)
+		go func() {
+			resp, err := http.Post("http://"+addr, "application/json", strings.NewReader(slow))
+			if err != nil {
+				done <- 0
+				return
+			}
+			_ = resp.Body.Close()
+			done <- resp.StatusCode
+		}()
+		<-svc.started
+		if status, b := post(t, addr, fast); status != http.StatusServiceUnavailable || responseCode(t, b) != common.Overloaded {
+			t.Errorf("overloaded call = %d %s", status, b)
+		}
+		close(svc.release)
+		if status := <-done; status != http.StatusOK {
+			t.Errorf("slow call status = %d", status)
+		}
+	})
+	t.Run("tcp", func(t *testing.T) {
+		svc := newSlowService()
+		_, addr := startTcp(t, svc, func(s *Tcp) { s.Options.MaxInFlight = 1 })
+		c := dial(t, addr)
+		c.send(t, slow)
+		<-svc.started
+		if b := dial(t, addr).call(t, fast); responseCode(t, b) != common.Overloaded {
+			t.Errorf("overloaded call = %s", b)
+		}
+		close(svc.release)
+		if b := c.receive(t); responseCode(t, b) != common.WithoutError {
+			t.Errorf("slow call = %s", b)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
+)
+
+const slowRequest = `{"jsonrpc":"2.0","id":"1","method":"svc.slow","params":{"n":7}}`
+
+// get 发送 GET 请求，返回状态码与响应体
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := readAll(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, b
+}
+
+// waitRefused 等待服务端停止接收新的连接
+func waitRefused(t *testing.T, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatalf("%s still accepting connections", addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHttpHealth(t *testing.T) {
+	s, addr := startHttp(t, newSlowService(), nil)
+	health := func() (int, common.Health) {
+		t.Helper()
+		status, b := get(t, "http://"+addr+"/readyz")
+		var h common.Health
+		if err := json.Unmarshal(b, &h); err != nil {
+			t.Fatalf("readyz %s: %v", b, err)
+		}
+		return status, h
+	}
+
+	if status, b := get(t, "http://"+addr+"/healthz"); status != http.StatusOK || string(b) != `{"status":"ok"}` {
+		t.Errorf("healthz = %d %s", status, b)
+	}
+	if status, h := health(); status != http.StatusOK || h.Status != common.StatusOK || !h.Ready {
+		t.Errorf("readyz = %d %+v", status, h)
+	}
+
+	s.AddHealthCheck("db", func(ctx context.Context) error { return nil })
+	s.AddHealthCheck("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+	status, h := health()
+	if status != http.StatusServiceUnavailable || h.Status != common.StatusFail || h.Checks["db"].Status != common.StatusOK || h.Checks["cache"].Error != "connection refused" {
+		t.Errorf("failing check: readyz = %d %+v", status, h)
+	}
+
+	// 未就绪时 /readyz 返回 503，/healthz 仍然返回 200
+	s.AddHealthCheck("cache", func(ctx context.Context) error { return nil })
+	s.SetReady(false)
+	if status, h = health(); status != http.StatusServiceUnavailable || h.Status != common.StatusNotReady || h.Ready {
+		t.Errorf("not ready: readyz = %d %+v", status, h)
+	}
+	if status, _ := get(t, "http://"+addr+"/healthz"); status != http.StatusOK {
+		t.Errorf("not ready: healthz = %d", status)
+	}
+	s.SetReady(true)
+	if status, _ = health(); status != http.StatusOK {
+		t.Errorf("ready again: readyz = %d", status)
+	}
+}
+
+// 关闭时先标记为未就绪并等待 ShutdownDelay，然后停止接收连接，处理中的请求正常返回
+func TestHttpShutdownDrains(t *testing.T) {
+	svc := newSlowService()
+	s, addr := startHttp(t, svc, func(s *Http) {
+		o := s.Options
+		o.ShutdownDelay = 300 * time.Millisecond
+		s.SetOptions(o)
+	})
+	type result struct {
+		status int
+		body   []byte
+		err    error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Post("http://"+addr, "application/json", strings.NewReader(slowRequest))
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		b, err := readAll(resp)
+		slow <- result{resp.StatusCode, b, err}
+	}()
+	<-svc.started
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- s.Shutdown(ctx)
+	}()
+
+	// 等待期间未就绪，仍然处理新的请求
+	deadline := time.Now().Add(time.Second)
+	for s.Server.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("server still ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if status, _ := get(t, "http://"+addr+"/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("readyz during delay = %d", status)
+	}
+	if status, b := post(t, addr, fastRequest); status != http.StatusOK || responseCode(t, b) != common.WithoutError {
+		t.Errorf("call during delay = %d %s", status, b)
+	}
+
+	waitRefused(t, addr)
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("stopped accepting after %v, want at least ShutdownDelay", d)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the slow call finished", err)
+	default:
+	}
+
+	close(svc.release)
+	r := <-slow
+	if r.err != nil || r.status != http.StatusOK || responseCode(t, r.body) != common.WithoutError || !strings.Contains(string(r.body), `"result":7`) {
+		t.Errorf("slow call = %d %s %v", r.status, r.body, r.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
+
+func TestTcpShutdownDrains(t *testing.T) {
+	svc := newSlowService()
+	s, addr := startTcp(t, svc, func(s *Tcp) {
+		o := s.Options
+		o.ShutdownDelay = 300 * time.Millisecond
+		s.SetOptions(o)
+	})
+	busy := dial(t, addr)
+	idle := dial(t, addr)
+	idle.call(t, fastRequest)
+	busy.send(t, slowRequest)
+	<-svc.started
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- s.Shutdown(ctx)
+	}()
+
+	// 等待期间 rpc.health 返回未就绪，已有连接仍然可以调用
+	deadline := time.Now().Add(time.Second)
+	for {
+		b := idle.call(t, `{"jsonrpc":"2.0","id":"h","method":"rpc.health"}`)
+		if strings.Contains(string(b), common.StatusNotReady) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rpc.health = %s", b)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	waitRefused(t, addr)
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("stopped accepting after %v, want at least ShutdownDelay", d)
+	}
+	close(svc.release)
+	if b := busy.receive(t); responseCode(t, b) != common.WithoutError || !strings.Contains(string(b), `"result":7`) {
+		t.Errorf("slow call = %s", b)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	// 关闭后连接被断开
+	_ = busy.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := busy.r.ReadByte(); err == nil {
+		t.Error("connection still open after Shutdown")
+	}
+}
+
+// 等待超时后强制关闭连接并返回 ctx 的错误
+func TestTcpShutdownTimeout(t *testing.T) {
+	svc := newSlowService()
+	defer close(svc.release)
+	s, addr := startTcp(t, svc, nil)
+	c := dial(t, addr)
+	c.send(t, slowRequest)
+	<-svc.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want deadline exceeded", err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("connection still open after forced shutdown")
+	}
+}
@@ -1,14 +1,16 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"crm/jsonrpc/common"
 	"fmt"
+	"github.com/zhouyaozhouyao/goframe-jsonrpc/common"
 	"golang.org/x/time/rate"
+	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Tcp struct {
@@ -16,11 +18,27 @@ type Tcp struct {
 	Port    string
 	Server  common.Server
 	Options TcpOptions
+	conns   int64 // 当前的连接数
+
+	mu       sync.Mutex
+	listener net.Listener
+	cancel   context.CancelFunc    // 取消所有连接上的请求
+	active   map[net.Conn]struct{} // 正在处理的连接，关闭时等待这些连接结束
+	closing  int32                 // 正在关闭，不再读取新的请求
 }
 
 type TcpOptions struct {
-	PackageEof       string
-	PackageMaxLength int64
+	PackageEof         string
+	PackageMaxLength   int64
+	PackageLengthCheck bool              // 使用 4 字节包头的长度检测协议，对应 hyperf 的 jsonrpc-tcp-length-check，二进制编码必须开启
+	Codec              common.Codec      // 消息编码，默认为 json
+	Compressor         common.Compressor // 压缩算法，需要开启 PackageLengthCheck，客户端需要使用相同的算法
+	CompressThreshold  int               // 压缩阈值，小于该长度的消息不压缩，不大于 0 时使用 common.DefaultCompressThreshold
+	MaxConnections     int               // 最大连接数，超过时返回 Overloaded 错误并关闭连接，不大于 0 时不限制
+	MaxInFlight        int               // 所有方法同时执行的最大调用数，不大于 0 时不限制，通过 SetOptions 设置或在 Start 前修改
+	MaxQueue           int               // 超过 MaxInFlight 时排队的最大调用数，队列已满时返回 Overloaded 错误
+	QueueTimeout       time.Duration     // 排队的最长时间，为 0 时一直等待
+	ShutdownDelay      time.Duration     // 关闭时先标记为未就绪，等待该时间让负载均衡摘除实例后再停止接收连接
 }
 
 // NewTcpServer 建立 TcpServer 服务
@@ -43,33 +61,201 @@ func NewTcpServer(ip string, port string) *Tcp {
 
 // Start 启动 tcp 服务
 func (p *Tcp) Start() {
+	if err := common.CheckFraming(p.Options.Codec, p.Options.Compressor, p.Options.PackageLengthCheck); err != nil {
+		log.Println(err)
+		return
+	}
+	// 直接修改 Options 设置的并发限制在启动时生效
+	if p.Options.MaxInFlight > 0 {
+		p.Server.SetConcurrency(p.concurrency())
+	}
 	var address = fmt.Sprintf("%s:%s", p.Ip, p.Port)
 	tcpAddr, err := net.ResolveTCPAddr("tcp", address) // 解析 Tcp 服务
 	if err != nil {
 		common.Debug(err.Error())
 	}
 
-	listener, _ := net.ListenTCP("tcp", tcpAddr)
+	listener, err := net.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		log.Println(err)
+		return
+	}
 	log.Printf("Listening tcp://%s:%s", p.Ip, p.Port)
+	// 连接上的请求在 Shutdown 等待超时后取消，Start 返回时不取消
 	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	p.mu.Lock()
+	p.listener, p.cancel = listener, cancel
+	p.mu.Unlock()
 	for {
 		conn, err := listener.AcceptTCP()
 		if err != nil {
-			common.Debug(err.Error())
+			if atomic.LoadInt32(&p.closing) == 1 {
+				return
+			}
+			common.DebugContext(ctx, err.Error())
 			continue
 		}
-		go p.handleFunc(ctx, conn)
+		// 超过最大连接数时直接拒绝，不再为新连接启动协程处理请求
+		if atomic.AddInt64(&p.conns, 1) > int64(p.Options.MaxConnections) && p.Options.MaxConnections > 0 {
+			atomic.AddInt64(&p.conns, -1)
+			go p.reject(conn)
+			continue
+		}
+		p.track(conn, true)
+		go func() {
+			sm := p.Server.Metrics()
+			if sm != nil {
+				sm.Connections.Add(1, "tcp")
+			}
+			p.handleFunc(ctx, conn)
+			p.track(conn, false)
+			atomic.AddInt64(&p.conns, -1)
+			if sm != nil {
+				sm.Connections.Add(-1, "tcp")
+			}
+		}()
+	}
+}
+
+// track 记录正在处理的连接
+func (p *Tcp) track(conn net.Conn, add bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active == nil {
+		p.active = make(map[net.Conn]struct{})
+	}
+	if add {
+		p.active[conn] = struct{}{}
+	} else {
+		delete(p.active, conn)
 	}
 }
 
+// Shutdown 优雅关闭，先标记为未就绪，等待 ShutdownDelay 后停止接收连接
+// 空闲的连接立即关闭，处理中的连接在返回当前响应后关闭，ctx 取消时强制关闭所有连接
+func (p *Tcp) Shutdown(ctx context.Context) error {
+	p.Server.SetReady(false)
+	if p.Options.ShutdownDelay > 0 {
+		select {
+		case <-time.After(p.Options.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+	atomic.StoreInt32(&p.closing, 1)
+	p.mu.Lock()
+	listener, cancel := p.listener, p.cancel
+	p.mu.Unlock()
+	if listener != nil {
+		_ = listener.Close()
+	}
+	if cancel != nil {
+		defer cancel()
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if p.drain(false) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			p.drain(true)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain 中断空闲连接的读取，force 为 true 时直接关闭所有连接，没有剩余连接时返回 true
+func (p *Tcp) drain(force bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for conn := range p.active {
+		if force {
+			_ = conn.Close()
+		} else {
+			_ = conn.SetReadDeadline(time.Now())
+		}
+	}
+	return len(p.active) == 0
+}
+
+// AddHealthCheck 添加健康检查
+func (p *Tcp) AddHealthCheck(name string, check common.HealthCheck) {
+	p.Server.AddHealthCheck(name, check)
+}
+
+// SetReady 设置是否就绪
+func (p *Tcp) SetReady(ready bool) {
+	p.Server.SetReady(ready)
+}
+
+// reject 连接数超过限制时返回 Overloaded 错误并关闭连接
+func (p *Tcp) reject(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	res, err := common.Encode(p.Options.Codec, common.E(nil, common.JsonRpc, common.Overloaded))
+	if err != nil {
+		return
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = conn.Write(common.PackFrame(res, p.Options.PackageEof, p.Options.PackageLengthCheck))
+}
+
 // Register 注册服务
-func (p *Tcp) Register(s interface{}) {
-	_ = p.Server.Register(s)
+func (p *Tcp) Register(s interface{}) error {
+	return p.Server.Register(s)
+}
+
+// RegisterName 以指定的名称注册服务
+func (p *Tcp) RegisterName(name string, s interface{}) error {
+	return p.Server.RegisterName(name, s)
+}
+
+// Replace 替换已注册的服务
+func (p *Tcp) Replace(name string, s interface{}) error {
+	return p.Server.Replace(name, s)
+}
+
+// Unregister 注销服务
+func (p *Tcp) Unregister(name string) error {
+	return p.Server.Unregister(name)
+}
+
+// RegisterFunc 将函数注册为指定名称的方法
+func (p *Tcp) RegisterFunc(name string, fn interface{}) error {
+	return p.Server.RegisterFunc(name, fn)
+}
+
+// Alias 为已注册的方法设置别名
+func (p *Tcp) Alias(alias string, method string) error {
+	return p.Server.Alias(alias, method)
+}
+
+// SetStrict 设置严格模式，服务存在签名错误的导出方法时注册失败
+func (p *Tcp) SetStrict(strict bool) {
+	p.Server.Strict = strict
+}
+
+// SetStrictParams 设置参数严格模式，不允许未知字段、缺少必填字段以及类型转换
+func (p *Tcp) SetStrictParams(strict bool) {
+	p.Server.StrictParams = strict
+}
+
+// SetNaming 设置服务名与方法名的命名策略，需要在注册服务前调用
+func (p *Tcp) SetNaming(naming common.NamingStrategy) {
+	p.Server.Naming = naming
 }
 
 func (p *Tcp) SetOptions(tcpOptions interface{}) {
 	p.Options = tcpOptions.(TcpOptions)
+	p.Server.SetConcurrency(p.concurrency())
+}
+
+// concurrency 按配置生成全局并发限制
+func (p *Tcp) concurrency() common.Concurrency {
+	return common.Concurrency{Max: p.Options.MaxInFlight, Queue: p.Options.MaxQueue, QueueTimeout: p.Options.QueueTimeout}
 }
 
 // SetRateLimit 限流器
@@ -77,6 +263,46 @@ func (p *Tcp) SetRateLimit(r rate.Limit, b int) {
 	p.Server.RateLimiter = rate.NewLimiter(r, b)
 }
 
+// SetAuth 设置认证方式
+func (p *Tcp) SetAuth(o common.AuthOptions) {
+	p.Server.SetAuth(o)
+}
+
+// SetSign 开启请求签名校验
+func (p *Tcp) SetSign(o common.SignOptions) {
+	p.Server.SetSign(o)
+}
+
+// SetACL 设置方法级别的访问控制规则
+func (p *Tcp) SetACL(acl *common.ACL) {
+	p.Server.SetACL(acl)
+}
+
+// AddRateLimit 添加分组限流规则
+func (p *Tcp) AddRateLimit(rule common.RateLimit) {
+	p.Server.AddRateLimit(rule)
+}
+
+// SetMetrics 开启指标，r 为 nil 时关闭，注册指标失败时返回错误
+func (p *Tcp) SetMetrics(r *common.Registry) error {
+	return p.Server.SetMetrics(r)
+}
+
+// SetLog 设置访问日志
+func (p *Tcp) SetLog(o common.LogOptions) {
+	p.Server.SetLog(o)
+}
+
+// SetTracing 开启链路追踪
+func (p *Tcp) SetTracing(t *common.Tracing) {
+	p.Server.SetTracing(t)
+}
+
+// SetMethodConcurrency 限制单个方法的并发调用数
+func (p *Tcp) SetMethodConcurrency(method string, c common.Concurrency) error {
+	return p.Server.SetMethodConcurrency(method, c)
+}
+
 func (p *Tcp) SetBeforeFunc(beforeFunc func(id interface{}, method string, params interface{}) error) {
 	p.Server.Hooks.BeforeFunc = beforeFunc
 }
@@ -98,29 +324,37 @@ func (p *Tcp) handleFunc(ctx context.Context, conn net.Conn) {
 
 	}
 
-	eofb := []byte(p.Options.PackageEof)
-	eofl := len(eofb)
+	codec := p.Options.Codec
+	framer := common.NewFramer(conn, p.Options.PackageEof, p.Options.PackageLengthCheck, p.Options.PackageMaxLength)
+	framer.SetCompressor(p.Options.Compressor, common.CompressThreshold(p.Options.CompressThreshold))
+	// 按协议封装后写入，流式分片与最终响应共用该函数，消息已经按连接的编码序列化
+	send := func(b []byte) error {
+		b, err := framer.Pack(b)
+		if err != nil {
+			return err
+		}
+		_, err = conn.Write(b)
+		return err
+	}
+	peer := &common.Peer{Transport: "tcp", RemoteAddr: conn.RemoteAddr().String()}
+	ctx = common.WithPeer(ctx, peer)
 	for {
-		var data []byte
-		l := 0
-		for {
-			var buf = make([]byte, p.Options.PackageMaxLength)
-			n, err := conn.Read(buf)
-			if err != nil {
-				if n == 0 {
-					return
-				}
-				common.Debug(err.Error())
-			}
-			l += n
-			data = append(data, buf[:n]...)
-			// 检测两个字符串的长度和所包含的字节是否相同
-			if bytes.Equal(data[l-eofl:], eofb) {
-				break
+		data, err := framer.ReadFrame()
+		if err != nil {
+			if err != io.EOF && atomic.LoadInt32(&p.closing) == 0 {
+				common.DebugContext(ctx, err.Error())
 			}
+			return
+		}
+		peer.Reset()
+		res := p.Server.HandlerCodec(common.WithSender(ctx, send), codec, data)
+		if err = send(res); err != nil {
+			common.DebugContext(ctx, err.Error())
+			return
+		}
+		// 关闭时返回当前响应后结束连接
+		if atomic.LoadInt32(&p.closing) == 1 {
+			return
 		}
-		res := p.Server.Handler(data[:l-eofl])
-		res = append(res, eofb...)
-		_, _ = conn.Write(res)
 	}
 }